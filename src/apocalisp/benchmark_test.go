@@ -0,0 +1,50 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"testing"
+)
+
+// Eval_Benchmark runs in in an environment prepared by setup, with both
+// Interpret and Evaluate so that the compiler can be compared to it.
+func Eval_Benchmark(b *testing.B, setup string, in string) {
+	for name, eval := range map[string]func(*core.Type, *core.Environment) (*core.Type, error){"interpret": Interpret, "evaluate": Evaluate} {
+		b.Run(name, func(b *testing.B) {
+			environment := DefaultEnvironment(parser.Parser{}, eval)
+			if _, err := Rep(setup, environment, eval, parser.Parser{}); err != nil {
+				b.Fatal(err)
+			}
+			node, err := parser.Parser{}.Parse(in)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if result, err := eval(node, environment); err != nil {
+					b.Fatal(err)
+				} else if result.IsException() {
+					b.Fatal(result.ToString(false))
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_Fibonacci(b *testing.B) {
+	Eval_Benchmark(b, `(def! fib (fn* (n) (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))))`, `(fib 15)`)
+}
+
+func Benchmark_Factorial(b *testing.B) {
+	Eval_Benchmark(b, `(with-out-str (load-file "../../examples/factorial.lisp"))`, `(factorial 1000)`)
+}
+
+func Benchmark_Map_Reduce(b *testing.B) {
+	Eval_Benchmark(b, `(do (def! double (fn* (xs n) (if (= n 0) xs (double (concat xs xs) (- n 1))))) (def! numbers (vec (double [1 2 3 4 5 6 7 8] 10))))`, `(apply + (map (fn* (x) (* x x)) numbers))`)
+}
+
+func Benchmark_String_Building(b *testing.B) {
+	Eval_Benchmark(b, `(def! build (fn* (n s) (if (= n 0) s (build (- n 1) (str s n ",")))))`, `(count (build 1000 ""))`)
+}
@@ -0,0 +1,43 @@
+package apocalisp
+
+import (
+	"testing"
+)
+
+func Test_Closures_Capture_Frames(t *testing.T) {
+	Repl_Test(`(do (def! make (fn* (x) (fn* () x))) [((make 1)) ((make 2))])`, `[1 2]`, t)
+	Repl_Test(`(let* [c (atom 0) bump (fn* () (swap! c + 1))] (do (bump) (bump) @c))`, `2`, t)
+	Repl_Test(`(let* [x 1] (let* [f (fn* () x)] (let* [x 2] (f))))`, `1`, t)
+	Repl_Test(`(do (def! x 5) ((fn* (a x) x) 1))`, `5`, t)
+}
+
+func Test_Closures_See_Later_Definitions(t *testing.T) {
+	Repl_Test(`(do (def! even? (fn* (n) (if (= n 0) true (odd? (- n 1))))) (def! odd? (fn* (n) (if (= n 0) false (even? (- n 1))))) (even? 10))`, `true`, t)
+	Repl_Test(`(let* [f (fn* () later)] (do (def! later 2) (f)))`, `2`, t)
+	Repl_Test(`(do (def! outer (fn* () (let* [f (fn* () (g))] (do (def! g (fn* () :local)) (f))))) (outer))`, `:local`, t)
+	Repl_Test(`(let* [x 1] (let* [f (fn* () x)] (do (def! x 2) (f))))`, `2`, t)
+	Repl_Test(`(let* [x 1] (let* [f (fn* () x) y 0] (do (def! x 2) [(f) x])))`, `[2 2]`, t)
+}
+
+func Test_Closures_See_Redefinitions(t *testing.T) {
+	Repl_Test(`(do (def! g (fn* () 1)) (def! f (fn* () (g))) (def! g (fn* () 2)) (f))`, `2`, t)
+	Repl_Test(`(do (def! n 1) (def! f (fn* () n)) (def! n 2) (f))`, `2`, t)
+	Repl_Test(`(do (def! f (fn* (x) (do (def! x (+ x 1)) x))) (f 1))`, `2`, t)
+}
+
+func Test_Closures_Keep_Definitions_Local(t *testing.T) {
+	Repl_Test(`(do (def! f (fn* () (do (def! local 1) local))) (f) (try* local (catch* e e)))`, `"'local' not found"`, t)
+	Repl_Test(`(let* [x 1] (do ((fn* () (def! x 2))) x))`, `1`, t)
+}
+
+func Test_Closures_Agree_With_Interpret(t *testing.T) {
+	for _, in := range []string{
+		`(let* [x 1] (let* [f (fn* () x)] (do (def! x 2) (f))))`,
+		`(let* [f (fn* () later)] (do (def! later 2) (f)))`,
+		`(do (def! f (fn* () (do (def! local 1) local))) (f) (try* local (catch* e e)))`,
+		`(let* [x 1] (do ((fn* () (def! x 2))) x))`,
+		`(do (def! make (fn* (x) (fn* () (do (def! x (+ x 1)) x)))) (let* [c (make 0)] [(c) (c) ((make 0))]))`,
+	} {
+		Compile_Test(in, t)
+	}
+}
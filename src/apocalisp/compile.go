@@ -0,0 +1,547 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"errors"
+	"sync/atomic"
+)
+
+// compiled runs a form. Rather than calling a function itself, it may return
+// the call for run to loop on.
+type compiled func(environment *core.Environment) (*core.Type, *tailCall, error)
+
+type tailCall struct {
+	body        compiled
+	environment *core.Environment
+}
+
+// scope lists the names bound by the frames the compiled code creates,
+// innermost first, so that references to them compile to slots.
+type scope struct {
+	names []string
+	outer *scope
+}
+
+// resolve returns how many frames out symbol is bound, and its slot there. The
+// slot is negative when symbol isn't bound by any of the frames.
+func (s *scope) resolve(symbol string) (int, int) {
+	depth := 0
+	if _, qualified := core.Unqualified(symbol); qualified {
+		return depth, -1
+	}
+	for ; s != nil; s, depth = s.outer, depth+1 {
+		for i, name := range s.names {
+			if name == symbol {
+				return depth, i
+			}
+		}
+	}
+	return depth, -1
+}
+
+// compiler compiles forms for an evaluator: Evaluate's runs them without
+// limits, a Sandbox's enforces its own.
+type compiler struct {
+	limits *limiter
+}
+
+var unlimited = &compiler{}
+
+// errStale is returned by compiled code whose macros changed since it was
+// compiled, for lazily to compile the form again.
+var errStale = errors.New("Error: stale macro expansion.")
+
+// Evaluate compiles node, then runs it. It has the semantics of Interpret: a
+// form is compiled again when a macro it expanded is redefined.
+func Evaluate(node *core.Type, environment *core.Environment) (*core.Type, error) {
+	return unlimited.evaluate(node, environment)
+}
+
+func (c *compiler) evaluate(node *core.Type, environment *core.Environment) (*core.Type, error) {
+	code, err := c.compile(*node, environment, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.run(code, environment)
+}
+
+func (c *compiler) run(code compiled, environment *core.Environment) (*core.Type, error) {
+	if c.limits != nil {
+		if exception, err := c.limits.enter(); exception != nil || err != nil {
+			return exception, err
+		}
+		defer c.limits.leave()
+	}
+
+	for {
+		value, call, err := code(environment)
+		if call == nil {
+			return value, err
+		}
+		code, environment = call.body, call.environment
+	}
+}
+
+// lazily compiles node the first time it's run, once the macros defined
+// before it exist, and again when they're redefined.
+func (c *compiler) lazily(node core.Type, scope *scope) compiled {
+	var code atomic.Pointer[compiled]
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		if c.limits != nil {
+			if exception, err := c.limits.step(); exception != nil || err != nil {
+				return exception, nil, err
+			}
+		}
+		if atomic.LoadInt32(&interrupted) != 0 {
+			return interruptedException(), nil, nil
+		} else if environment.Bindings().IsCancelled() {
+			return cancelledException("future"), nil, nil
+		}
+
+		if loaded := code.Load(); loaded != nil {
+			if value, call, err := (*loaded)(environment); err != errStale {
+				return value, call, err
+			}
+		}
+		compiled, err := c.compile(node, environment, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		code.Store(&compiled)
+		return compiled(environment)
+	}
+}
+
+func (c *compiler) limited(value *core.Type, err error) (*core.Type, *tailCall, error) {
+	if c.limits != nil && err == nil {
+		if exception, err := c.limits.size(value); exception != nil || err != nil {
+			return exception, nil, err
+		}
+	}
+	return value, nil, err
+}
+
+func (c *compiler) compileAll(nodes []core.Type, scope *scope) []compiled {
+	codes := make([]compiled, len(nodes))
+	for i := range nodes {
+		codes[i] = c.lazily(nodes[i], scope)
+	}
+	return codes
+}
+
+func constant(node core.Type) compiled {
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		return &node, nil, nil
+	}
+}
+
+func lookup(symbol string, scope *scope) func(*core.Environment) core.Type {
+	depth, index := scope.resolve(symbol)
+	if index < 0 {
+		global := &core.Global{}
+		return func(environment *core.Environment) core.Type {
+			return environment.ResolvedGlobal(depth, symbol, global)
+		}
+	}
+	return func(environment *core.Environment) core.Type {
+		return environment.Resolved(depth, index, symbol)
+	}
+}
+
+type expandedMacro struct {
+	lookup func(*core.Environment) core.Type
+	macro  *core.Function
+}
+
+func (c *compiler) compile(node core.Type, environment *core.Environment, scope *scope) (compiled, error) {
+	var macros []expandedMacro
+	for {
+		var macro core.Type
+		if !isMacroCall(node, environment, func(m core.Type) { macro = m }) {
+			break
+		}
+		macros = append(macros, expandedMacro{lookup(node.AsIterable()[0].AsSymbol(), scope), macro.Function})
+		node, _ = macroexpand1(node, environment)
+	}
+
+	code, err := c.compileExpanded(node, scope)
+	if err != nil || len(macros) == 0 {
+		return code, err
+	}
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		for _, expanded := range macros {
+			if expanded.lookup(environment).Function != expanded.macro {
+				return nil, nil, errStale
+			}
+		}
+		return code(environment)
+	}, nil
+}
+
+func (c *compiler) compileExpanded(node core.Type, scope *scope) (compiled, error) {
+	if node.IsSymbol() && !node.IsKeyword() {
+		get := lookup(node.AsSymbol(), scope)
+		return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+			value := get(environment)
+			return &value, nil, nil
+		}, nil
+	} else if node.IsList() && !node.IsEmptyIterable() {
+		return c.compileList(node, scope)
+	} else if node.IsIterable() {
+		return c.compileIterable(node, scope), nil
+	} else if node.IsHashmap() {
+		return c.compileHashmap(node, scope), nil
+	}
+	return constant(node), nil
+}
+
+func (c *compiler) compileIterable(node core.Type, scope *scope) compiled {
+	codes := c.compileAll(node.AsIterable(), scope)
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		newIterable := node.DeriveIterable()
+		for _, code := range codes {
+			if evaluated, err := c.run(code, environment); err != nil {
+				return nil, nil, err
+			} else {
+				newIterable.Append(*evaluated)
+			}
+		}
+		return c.limited(newIterable, nil)
+	}
+}
+
+func (c *compiler) compileHashmap(node core.Type, scope *scope) compiled {
+	keys, values := make([]core.HashmapKey, 0), make([]core.Type, 0)
+	for key, value := range node.AsHashmap() {
+		keys, values = append(keys, key), append(values, value)
+	}
+	codes := c.compileAll(values, scope)
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		newHashmap := core.NewHashmap()
+		for i, code := range codes {
+			if evaluated, err := c.run(code, environment); err != nil {
+				return nil, nil, err
+			} else {
+				newHashmap.HashmapSet(keys[i], *evaluated)
+			}
+		}
+		return c.limited(newHashmap, nil)
+	}
+}
+
+// compileList resolves the special form a list stands for, in the order
+// Interpret tries them.
+func (c *compiler) compileList(node core.Type, scope *scope) (compiled, error) {
+	first, rest := node.AsIterable()[0], node.AsIterable()[1:]
+	source := node.Source
+
+	if first.CompareSymbol("def!") {
+		return c.compileSpecialForm(rest, scope, func(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+			return specialFormDef(eval, rest, environment, source)
+		}), nil
+	} else if first.CompareSymbol("defmacro!") {
+		return c.compileSpecialForm(rest, scope, func(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+			return specialFormDefmacro(eval, rest, environment, source)
+		}), nil
+	} else if first.CompareSymbol("def-dynamic!") {
+		return c.compileSpecialForm(rest, scope, func(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+			return specialFormDefDynamic(eval, rest, environment, source)
+		}), nil
+	} else if first.CompareSymbol("macroexpand") {
+		return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+			expanded := macroexpand(rest[0], environment)
+			return &expanded, nil, nil
+		}, nil
+	} else if first.CompareSymbol("macroexpand-1") {
+		return c.compileSpecialForm(rest, scope, specialFormMacroexpand1), nil
+	} else if first.CompareSymbol("macroexpand-all") {
+		return c.compileSpecialForm(rest, scope, specialFormMacroexpandAll), nil
+	} else if first.CompareSymbol("macrostep") {
+		return c.compileSpecialForm(rest, scope, specialFormMacrostep), nil
+	} else if first.CompareSymbol("let*") {
+		return c.compileLet(rest, scope)
+	} else if first.CompareSymbol("do") {
+		return c.compileDo(rest, scope)
+	} else if first.CompareSymbol("fn*", `\`) {
+		return c.compileFn(rest, scope)
+	} else if first.CompareSymbol("if") {
+		return c.compileIf(rest, scope)
+	} else if first.CompareSymbol("quasiquote") {
+		if len(rest) < 1 {
+			return nil, errors.New("Error: Invalid syntax for `quasiquote`.")
+		}
+		if !hasAutoGensyms(rest[0]) {
+			return c.lazily(quasiquote(rest[0]), scope), nil
+		}
+		// every expansion generates its own symbols
+		return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+			code, err := c.compile(quasiquote(rest[0]), environment, scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			return code(environment)
+		}, nil
+	} else if first.CompareSymbol("syntax-quote") {
+		if len(rest) < 1 {
+			return nil, errors.New("Error: Invalid syntax for `syntax-quote`.")
+		}
+		// symbols are qualified depending on the environment
+		return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+			code, err := c.compile(syntaxQuote(rest[0], environment), environment, scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			return code(environment)
+		}, nil
+	} else if first.CompareSymbol("quasiquoteexpand") {
+		return c.compileSpecialForm(rest, scope, specialFormQuasiquoteexpand), nil
+	} else if first.CompareSymbol("quote") {
+		return c.compileSpecialForm(rest, scope, specialFormQuote), nil
+	} else if first.CompareSymbol("try*") {
+		return c.compileSpecialForm(rest, scope, specialFormTryCatch), nil
+	} else if first.CompareSymbol("with-open") {
+		return c.compileSpecialForm(rest, scope, specialFormWithOpen), nil
+	} else if first.CompareSymbol("binding") {
+		return c.compileSpecialForm(rest, scope, specialFormBinding), nil
+	} else if first.CompareSymbol("set!") {
+		return c.compileSpecialForm(rest, scope, specialFormSet), nil
+	} else if first.CompareSymbol("with-env") {
+		return c.compileSpecialForm(rest, scope, specialFormWithEnv), nil
+	} else if first.CompareSymbol("with-cwd") {
+		return c.compileSpecialForm(rest, scope, specialFormWithCwd), nil
+	} else if first.CompareSymbol("var") {
+		return c.compileSpecialForm(rest, scope, specialFormVar), nil
+	} else if first.CompareSymbol("with-out-str") {
+		return c.compileSpecialForm(rest, scope, specialFormWithOutStr), nil
+	} else if first.CompareSymbol("with-in-str") {
+		return c.compileSpecialForm(rest, scope, specialFormWithInStr), nil
+	}
+	return c.compileApplication(node.AsIterable(), scope), nil
+}
+
+// compileSpecialForm runs a special form shared with Interpret, whose eval
+// runs the compiled arguments.
+func (c *compiler) compileSpecialForm(rest []core.Type, scope *scope, form func(func(*core.Type, *core.Environment) (*core.Type, error), []core.Type, *core.Environment) (*core.Type, error)) compiled {
+	codes := c.compileAll(rest, scope)
+	eval := func(node *core.Type, environment *core.Environment) (*core.Type, error) {
+		for i := range rest {
+			if node == &rest[i] {
+				return c.run(codes[i], environment)
+			}
+		}
+		return c.evaluate(node, environment)
+	}
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		value, err := form(eval, rest, environment)
+		return value, nil, err
+	}
+}
+
+func (c *compiler) compileLet(rest []core.Type, outer *scope) (compiled, error) {
+	if len(rest) != 2 || !rest[0].IsEvenIterable() {
+		return nil, errors.New("Error: Invalid syntax for `let*`.")
+	}
+
+	bindings := rest[0].AsIterable()
+	symbols, values := make([]string, 0), make([]core.Type, 0)
+	for symbol, target := 0, 1; symbol < len(bindings); symbol, target = symbol+2, target+2 {
+		symbols, values = append(symbols, bindings[symbol].ToString(true)), append(values, bindings[target])
+	}
+	frame := &scope{names: core.Slots(symbols), outer: outer}
+	slots := make([]int, len(symbols))
+	for i, symbol := range symbols {
+		for slots[i] = 0; frame.names[slots[i]] != symbol; slots[i]++ {
+		}
+	}
+	codes, body := c.compileAll(values, frame), c.lazily(rest[1], frame)
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		letEnvironment := core.NewFrame(environment, frame.names)
+		for i, code := range codes {
+			if e, err := c.run(code, letEnvironment); err != nil {
+				return nil, nil, err
+			} else if e.IsException() {
+				return e, nil, nil
+			} else {
+				letEnvironment.Bind(slots[i], *e)
+			}
+		}
+		return body(letEnvironment)
+	}, nil
+}
+
+func (c *compiler) compileDo(rest []core.Type, scope *scope) (compiled, error) {
+	if len(rest) < 1 {
+		return nil, errors.New("Error: Invalid syntax for `do`.")
+	}
+
+	codes, last := c.compileAll(rest[:len(rest)-1], scope), c.lazily(rest[len(rest)-1], scope)
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		// like Interpret, every form is evaluated before the first exception
+		// is returned
+		var exception *core.Type
+		for _, code := range codes {
+			if e, err := c.run(code, environment); err != nil {
+				return nil, nil, err
+			} else if e.IsException() && exception == nil {
+				exception = e
+			}
+		}
+		if exception != nil {
+			return exception, nil, nil
+		}
+		return last(environment)
+	}, nil
+}
+
+func (c *compiler) compileIf(rest []core.Type, scope *scope) (compiled, error) {
+	length := len(rest)
+	if length < 2 || length > 3 {
+		return nil, errors.New("Error: Invalid syntax for `if`.")
+	}
+
+	condition, then, otherwise := c.lazily(rest[0], scope), c.lazily(rest[1], scope), constant(*core.NewNil())
+	if length == 3 {
+		otherwise = c.lazily(rest[2], scope)
+	}
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		if e, err := c.run(condition, environment); err != nil {
+			return nil, nil, err
+		} else if !e.IsNil() && !e.CompareBoolean(false) {
+			return then(environment)
+		}
+		return otherwise(environment)
+	}, nil
+}
+
+// parameters lays out the frame of a call: the slot of each positional
+// parameter, and of the list of the other arguments, or -1.
+type parameters struct {
+	names []string
+	slots []int
+	rest  int
+}
+
+func newParameters(symbols []string) *parameters {
+	layout := &parameters{names: core.Slots(symbols), rest: -1}
+	index := func(symbol string) int {
+		i := 0
+		for layout.names[i] != symbol {
+			i++
+		}
+		return i
+	}
+	for i, symbol := range symbols {
+		if symbol == "&" {
+			if i+1 < len(symbols) {
+				layout.rest = index(symbols[i+1])
+			} else {
+				layout.rest = index("&")
+			}
+			break
+		}
+		layout.slots = append(layout.slots, index(symbol))
+	}
+	return layout
+}
+
+func (layout *parameters) frame(outer *core.Environment, args []core.Type, bindings *core.Bindings) *core.Environment {
+	frame := core.NewFrame(outer, layout.names)
+	frame.SetBindings(bindings)
+	for i, slot := range layout.slots {
+		if i < len(args) {
+			frame.Bind(slot, args[i])
+		}
+	}
+	if layout.rest >= 0 {
+		rest := make([]core.Type, 0)
+		if len(layout.slots) < len(args) {
+			rest = args[len(layout.slots):]
+		}
+		frame.Bind(layout.rest, core.Type{List: &rest})
+	}
+	return frame
+}
+
+// compiledFunction is what compileFn leaves in Function.Compiled.
+type compiledFunction struct {
+	body       compiled
+	parameters *parameters
+}
+
+// compileFn compiles the body of a function once for every function the form
+// creates.
+func (c *compiler) compileFn(rest []core.Type, outer *scope) (compiled, error) {
+	if len(rest) < 2 || !rest[0].IsIterable() {
+		return nil, errors.New("Error: Invalid syntax for `fn*`.")
+	}
+
+	symbols := make([]string, 0)
+	for _, node := range rest[0].AsIterable() {
+		if !node.IsSymbol() {
+			return nil, errors.New("Error: Invalid syntax for `fn*`.")
+		}
+		symbols = append(symbols, node.AsSymbol())
+	}
+	layout := newParameters(symbols)
+	body := c.lazily(rest[1], &scope{names: layout.names, outer: outer})
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		callable := func(bindings *core.Bindings, args ...core.Type) core.Type {
+			frame := layout.frame(environment, args, bindings)
+			if result, err := c.run(body, frame); err != nil {
+				return *core.NewStringException(err.Error())
+			} else {
+				return *result
+			}
+		}
+
+		function := core.Function{
+			Params:      symbols,
+			Body:        rest[1],
+			Callable:    callable,
+			Environment: environment,
+			Compiled:    compiledFunction{body: body, parameters: layout},
+		}
+		return &core.Type{Function: &function}, nil, nil
+	}, nil
+}
+
+// compileApplication calls a function with the values of the other forms. A
+// compiled function is called by returning its body to run.
+func (c *compiler) compileApplication(forms []core.Type, scope *scope) compiled {
+	codes := c.compileAll(forms, scope)
+	named := forms[0].IsSymbol()
+
+	return func(environment *core.Environment) (*core.Type, *tailCall, error) {
+		values := make([]core.Type, len(codes))
+		for i, code := range codes {
+			if evaluated, err := c.run(code, environment); err != nil {
+				return nil, nil, err
+			} else if i == 0 && named && evaluated.IsMacroFunction() {
+				// the name was defined as a macro since
+				return nil, nil, errStale
+			} else {
+				values[i] = *evaluated
+			}
+		}
+
+		function, parameters := values[0], values[1:]
+		if !function.IsFunction() {
+			return c.limited(evalCallable(&core.Type{List: &values}, environment.Bindings()))
+		}
+
+		if code, ok := function.Function.Compiled.(compiledFunction); ok {
+			callEnvironment := code.parameters.frame(function.Function.Environment, parameters, environment.Bindings())
+			return nil, &tailCall{body: code.body, environment: callEnvironment}, nil
+		}
+		callEnvironment := core.NewEnvironment(function.Function.Environment, function.Function.Params, parameters)
+		callEnvironment.SetBindings(environment.Bindings())
+		value, err := Interpret(&function.Function.Body, callEnvironment)
+		return value, nil, err
+	}
+}
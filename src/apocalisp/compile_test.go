@@ -0,0 +1,94 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"testing"
+)
+
+// Compile_Test checks that Evaluate and Interpret agree on in.
+func Compile_Test(in string, t *testing.T) {
+	outputs := make([]string, 0)
+	for _, eval := range []func(*core.Type, *core.Environment) (*core.Type, error){Interpret, Evaluate} {
+		environment := DefaultEnvironment(parser.Parser{}, eval)
+		if out, err := Rep(in, environment, eval, parser.Parser{}); err != nil {
+			outputs = append(outputs, err.Error())
+		} else {
+			outputs = append(outputs, out)
+		}
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("%s: (compiled) `%s` != `%s` (interpreted)", in, outputs[1], outputs[0])
+	}
+}
+
+func Test_Compile_Agrees_With_Interpret(t *testing.T) {
+	for _, in := range []string{
+		`(let* [a 1 b (+ a 1)] [a b {:c (* b 2)}])`,
+		`(do (def! x 1) (def! x (+ x 1)) x)`,
+		`(if nil 1)`,
+		`(if (throw "x") 1 2)`,
+		`(do (throw "a") 3)`,
+		`(list 1 (throw "x"))`,
+		`((fn* (a & more) [a more]) 1 2 3)`,
+		`((fn* (f) (f 2)) (fn* (x) (* x x)))`,
+		`(try* (throw {:a 1}) (catch* e (get e :a)))`,
+		`(try* (undefined) (catch* e e))`,
+		`(let* [x 1] (quasiquote (a ~x ~@(list 2 3) [~x])))`,
+		`(macroexpand (when a 1))`,
+		`(with-out-str (println 1) (println 2))`,
+		`(binding [*file* "f"] *file*)`,
+		`(let*)`,
+		`(fn* (1) 1)`,
+		`(1 2)`,
+		`(do (def! n 0) (dotimes [i 5] (def! n (+ n i))) n)`,
+		`(for [x [1 2 3] :when (> x 1)] (* x 10))`,
+	} {
+		Compile_Test(in, t)
+	}
+}
+
+func Test_Compile_Expands_Macros_Defined_Before_Use(t *testing.T) {
+	Repl_Test(`(do (defmacro! twice (fn* (x) (list 'do x x))) (twice 1))`, `1`, t)
+	Repl_Test(`(do (def! f (fn* () (later))) (defmacro! later (fn* () 42)) (f))`, `42`, t)
+	Repl_Test(`(if true 1 (let* broken))`, `1`, t)
+}
+
+func Test_Compile_Expands_Redefined_Macros(t *testing.T) {
+	Repl_Test(`(do (defmacro! m (fn* () 1)) (def! f (fn* () (m))) (f) (defmacro! m (fn* () 2)) [(f) (m)])`, `[2 2]`, t)
+	Repl_Test(`(do (def! m (fn* () 1)) (def! f (fn* () (m))) (f) (defmacro! m (fn* () 2)) (f))`, `2`, t)
+	Repl_Test(`(do (defmacro! m (fn* () 1)) (def! f (fn* () (m))) (f) (def! m (fn* () 2)) (f))`, `2`, t)
+	Repl_Test(`(do (defmacro! m (fn* () 1)) (def! f (fn* () (when true (m)))) (f) (defmacro! m (fn* () 2)) (f))`, `2`, t)
+}
+
+func Test_Compile_Generates_Symbols_Per_Expansion(t *testing.T) {
+	Compile_Test(`(do (defmacro! mk (fn* (v) (quasiquote (do (def! c# ~v) (fn* () c#))))) (def! f1 (mk 1)) (def! f2 (mk 2)) [(f1) (f2)])`, t)
+	Repl_Test(`(do (defmacro! mk (fn* (v) (quasiquote (do (def! c# ~v) (fn* () c#))))) (def! f1 (mk 1)) (def! f2 (mk 2)) [(f1) (f2)])`, `[1 2]`, t)
+	Repl_Test(`(= (macroexpand (when-let [a 1] a)) (macroexpand (when-let [a 1] a)))`, `false`, t)
+}
+
+func Test_Compile_Tail_Calls(t *testing.T) {
+	Repl_Test(`(do (def! sum (fn* (n acc) (if (= n 0) acc (sum (- n 1) (+ acc n))))) (sum 10000 0))`, `50005000`, t)
+	Repl_Test(`(do (def! even (fn* (n) (if (= n 0) true (odd (- n 1))))) (def! odd (fn* (n) (if (= n 0) false (even (- n 1))))) (even 10001))`, `false`, t)
+	Repl_Test(`(do (def! loop (fn* (n) (let* [m (- n 1)] (do (if (= m 0) :done (loop m)))))) (loop 10000))`, `:done`, t)
+}
+
+func Test_Compile_Resolves_Locals(t *testing.T) {
+	for _, in := range []string{
+		`(let* [x 1 x (+ x 1) y x] [x y])`,
+		`(let* [user/x 1] user/x)`,
+		`(let* [+ -] (+ 3 1))`,
+		`((fn* (a b c) [a b]) 1 2)`,
+		`(do (def! c 3) ((fn* (a b c) c) 1 2))`,
+		`((fn* (a a) a) 1 2)`,
+		`((fn* (&) &) 1 2)`,
+		`(let* [a 1] (let* [b 2] (do (def! a 3) [a b])))`,
+		`(let* [a 1] ((fn* () (do (def! a 2) a))))`,
+		`(let* [f (fn* () b)] (do (def! b 2) (f)))`,
+		`(let* [x 1] (let* [y (fn* () x)] (let* [x 2] (y))))`,
+		`(let* [n 0] (let* [count (fn* (i) (if (< i 3) (count (+ i 1)) [i n]))] (count 0)))`,
+	} {
+		Compile_Test(in, t)
+	}
+}
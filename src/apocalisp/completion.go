@@ -0,0 +1,145 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// specialForms aren't bound in any environment, so they're completed from
+// this list.
+var specialForms = []string{
+	"binding", "def!", "def-dynamic!", "defmacro!", "do", "fn*", "if", "let*", "macroexpand", "macroexpand-1", "macroexpand-all",
+	"macrostep", "quasiquote", "quasiquoteexpand", "quote", "set!", "syntax-quote", "try*", "catch*", "var", "with-cwd", "with-env", "with-in-str", "with-open", "with-out-str",
+}
+
+var optionKeywords = []string{
+	":append", ":argv", ":dir", ":env", ":err", ":in", ":out", ":parents", ":recursive", ":timeout",
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("()[]{}'`~@^,;\"", r)
+}
+
+// withPrefix keeps the candidates starting with prefix, sorted and without
+// duplicates.
+func withPrefix(prefix string, candidates []string) []string {
+	seen, completions := make(map[string]bool), make([]string, 0)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) && !seen[candidate] {
+			seen[candidate] = true
+			completions = append(completions, candidate)
+		}
+	}
+	sort.Strings(completions)
+	return completions
+}
+
+// completePath completes prefix with the entries of its directory, resolved
+// against `*cwd*`. Directories end with a separator so completion can go on.
+func completePath(prefix string, environment *core.Environment) []string {
+	directory, base := filepath.Split(prefix)
+	entries, err := os.ReadDir(resolvePath(environment, directory))
+	if err != nil {
+		return []string{}
+	}
+
+	candidates := make([]string, 0)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if candidate := directory + entry.Name(); entry.IsDir() {
+			candidates = append(candidates, candidate+string(filepath.Separator))
+		} else {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return withPrefix(prefix, candidates)
+}
+
+// completeCommand completes the shell builtins and the programs found in the
+// `PATH` held by `*env*`.
+func completeCommand(prefix string, environment *core.Environment) []string {
+	if strings.ContainsRune(prefix, filepath.Separator) {
+		return completePath(prefix, environment)
+	}
+
+	candidates := make([]string, 0)
+	for builtin := range shellBuiltins {
+		candidates = append(candidates, builtin)
+	}
+	path, _ := getenv(environment, "PATH")
+	for _, directory := range filepath.SplitList(path) {
+		entries, _ := os.ReadDir(resolvePath(environment, directory))
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				candidates = append(candidates, entry.Name())
+			}
+		}
+	}
+	return withPrefix(prefix, candidates)
+}
+
+// completeKeyword completes the builtins' options and the keywords bound in
+// the environment, directly or as map keys.
+func completeKeyword(prefix string, environment *core.Environment) []string {
+	candidates := append([]string{}, optionKeywords...)
+	for _, symbol := range environment.Symbols() {
+		if value := environment.Get(symbol); value.IsKeyword() {
+			candidates = append(candidates, value.AsSymbol())
+		} else if value.IsHashmap() {
+			for key := range value.AsHashmap() {
+				if key.IsSymbol {
+					candidates = append(candidates, key.Identifier)
+				}
+			}
+		}
+	}
+	return withPrefix(prefix, candidates)
+}
+
+// completeShell completes command names at the start of commands and paths
+// everywhere else. pos is a byte offset.
+func completeShell(line string, pos int, environment *core.Environment) (string, []string, string) {
+	start := strings.LastIndexFunc(line[:pos], unicode.IsSpace) + 1
+	word, before := line[start:pos], strings.TrimRightFunc(line[:start], unicode.IsSpace)
+
+	if before == "" || strings.ContainsAny(before[len(before)-1:], "|;&") {
+		return line[:start], completeCommand(word, environment), line[pos:]
+	}
+	return line[:start], completePath(word, environment), line[pos:]
+}
+
+// complete completes file paths in strings, and symbols and keywords
+// elsewhere. pos counts runes, like liner does.
+func complete(line string, pos int, environment *core.Environment) (string, []string, string) {
+	pos = len(string([]rune(line)[:pos]))
+	if IsShellLine(line, environment) {
+		return completeShell(line, pos, environment)
+	}
+
+	inString, escaped, quote := false, false, 0
+	for i, r := range line[:pos] {
+		if escaped {
+			escaped = false
+		} else if r == '\\' && inString {
+			escaped = true
+		} else if r == '"' {
+			inString, quote = !inString, i
+		}
+	}
+	if inString {
+		return line[:quote+1], completePath(line[quote+1:pos], environment), line[pos:]
+	}
+
+	start := strings.LastIndexFunc(line[:pos], isDelimiter) + 1
+	word := line[start:pos]
+	if strings.HasPrefix(word, ":") {
+		return line[:start], completeKeyword(word, environment), line[pos:]
+	}
+	return line[:start], withPrefix(word, append(environment.Symbols(), specialForms...)), line[pos:]
+}
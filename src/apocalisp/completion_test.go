@@ -0,0 +1,72 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func Completion_Test(environment *core.Environment, line string, ehead string, ecompletions []string, t *testing.T) {
+	head, completions, tail := complete(line, utf8.RuneCountInString(line), environment)
+	if head != ehead || tail != "" || !reflect.DeepEqual(completions, ecompletions) {
+		t.Errorf("`%s`: (output) `%s` %v != `%s` %v (expected)", line, head, completions, ehead, ecompletions)
+	}
+}
+
+func Test_Complete_Symbols_And_Keywords(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	Rep(`(def! apocalisp-value {:apocalisp-key 1})`, environment, Evaluate, parser.Parser{})
+	inner := core.NewEnvironment(environment, []string{"apocalisp-local"}, []core.Type{*core.NewNumber(1)})
+
+	Completion_Test(inner, "(map apocalisp-", "(map ", []string{"apocalisp-local", "apocalisp-value"}, t)
+	Completion_Test(inner, "[(defm", "[(", []string{"defmacro", "defmacro!"}, t)
+	Completion_Test(inner, "(get x :apocalisp-", "(get x ", []string{":apocalisp-key"}, t)
+	Completion_Test(inner, "(spit f s :app", "(spit f s ", []string{":append"}, t)
+	Completion_Test(inner, "(str \"héllo\" apocalisp-l", "(str \"héllo\" ", []string{"apocalisp-local"}, t)
+}
+
+func Test_Complete_Counts_Runes(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	Rep(`(def! apocalisp-value 1)`, environment, Evaluate, parser.Parser{})
+
+	// liner places the cursor in runes: after `apocalisp-` here
+	head, completions, tail := complete("(list \"ü→\" apocalisp-) ; ✓", 21, environment)
+	if head != "(list \"ü→\" " || tail != ") ; ✓" || !reflect.DeepEqual(completions, []string{"apocalisp-value"}) {
+		t.Errorf("(output) `%s` %v `%s` != `(list \"ü→\" ` [apocalisp-value] `) ; ✓` (expected)", head, completions, tail)
+	}
+}
+
+func Test_Complete_Paths_In_Strings(t *testing.T) {
+	directory := t.TempDir()
+	os.Mkdir(filepath.Join(directory, "nested"), 0777)
+	os.WriteFile(filepath.Join(directory, "note.txt"), []byte{}, 0666)
+	os.WriteFile(filepath.Join(directory, ".hidden"), []byte{}, 0666)
+
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	Rep(fmt.Sprintf(`(cd "%s")`, directory), environment, Evaluate, parser.Parser{})
+
+	Completion_Test(environment, `(slurp "n`, `(slurp "`, []string{"nested/", "note.txt"}, t)
+	Completion_Test(environment, `(str "\")" "n`, `(str "\")" "`, []string{"nested/", "note.txt"}, t)
+	Completion_Test(environment, `(slurp ".h`, `(slurp "`, []string{".hidden"}, t)
+}
+
+func Test_Complete_Shell_Commands(t *testing.T) {
+	directory := t.TempDir()
+	os.WriteFile(filepath.Join(directory, "apocalisp-tool"), []byte{}, 0755)
+	os.WriteFile(filepath.Join(directory, "apocalisp-data"), []byte{}, 0644)
+
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	environment.Set("*shell-mode*", *core.NewBoolean(true))
+	Rep(fmt.Sprintf(`(do (setenv "PATH" "%s") (cd "%s"))`, directory, directory), environment, Evaluate, parser.Parser{})
+
+	Completion_Test(environment, "apocalisp-", "", []string{"apocalisp-tool"}, t)
+	Completion_Test(environment, "ls | apocalisp-", "ls | ", []string{"apocalisp-tool"}, t)
+	Completion_Test(environment, "cat apocalisp-", "cat ", []string{"apocalisp-data", "apocalisp-tool"}, t)
+	Completion_Test(environment, "f", "", []string{"fg"}, t)
+	Completion_Test(environment, "echo ünïcode apocalisp-d", "echo ünïcode ", []string{"apocalisp-data"}, t)
+}
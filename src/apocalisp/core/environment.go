@@ -2,29 +2,124 @@ package core
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// Namespace qualifies symbols so they resolve in the outermost environment,
+// skipping local bindings: `user/list` is always the global `list`.
+const Namespace = "user"
+
+func Unqualified(symbol string) (string, bool) {
+	if name := strings.TrimPrefix(symbol, Namespace+"/"); name != symbol && name != "" {
+		return name, true
+	}
+	return symbol, false
+}
+
 type Environment struct {
 	outer *Environment
+	// mutex guards the bindings, which futures may read and define
+	// concurrently
+	mutex sync.RWMutex
+	// names are the symbols bound to slots, e.g. the parameters of a
+	// function, in the order the compiler resolves them to
+	names []string
+	slots []Type
+	bound []bool
 	table map[string]Type
+	// generation counts the changes to the bindings Set makes, so that
+	// Global knows when its value is stale
+	generation atomic.Uint64
+	// metadata describes bindings rather than their values, e.g. the
+	// docstring given to `def!`
+	metadata map[string]Type
+	// the values of dynamic variables where the code of env runs
+	bindings *Bindings
+	// transparent environments only change the bindings: definitions go to
+	// their outer environment
+	transparent bool
+}
+
+// Slots returns the names of the slots NewEnvironment binds symbols to, each
+// of them once.
+func Slots(symbols []string) []string {
+	names := make([]string, 0, len(symbols))
+	for i := 0; i < len(symbols); i++ {
+		name := symbols[i]
+		if name == "&" && i+1 < len(symbols) {
+			name = symbols[i+1]
+		}
+		if slot(names, name) < 0 {
+			names = append(names, name)
+		}
+		if symbols[i] == "&" {
+			break
+		}
+	}
+	return names
+}
+
+func slot(names []string, symbol string) int {
+	for i, name := range names {
+		if name == symbol {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewFrame returns an environment with a slot for each of names, unbound
+// until Bind is called.
+func NewFrame(outer *Environment, names []string) *Environment {
+	environment := &Environment{
+		outer: outer,
+		names: names,
+		slots: make([]Type, len(names)),
+		bound: make([]bool, len(names)),
+	}
+	if outer != nil {
+		environment.bindings = outer.bindings
+	}
+	return environment
+}
+
+// WithBindings returns an environment evaluating code like env, but with
+// bindings in effect.
+func (env *Environment) WithBindings(bindings *Bindings) *Environment {
+	return &Environment{outer: env, bindings: bindings, transparent: true}
+}
+
+// Bindings returns the values of dynamic variables where the code of env
+// runs.
+func (env *Environment) Bindings() *Bindings {
+	return env.bindings
+}
+
+// SetBindings gives env, the frame of a call, the bindings of the caller. It
+// must be called before env is used.
+func (env *Environment) SetBindings(bindings *Bindings) {
+	env.bindings = bindings
 }
 
 func NewEnvironment(outer *Environment, symbols []string, nodes []Type) *Environment {
-	table := make(map[string]Type)
-	environment := &Environment{table: table, outer: outer}
+	environment := NewFrame(outer, Slots(symbols))
 
+	// a new frame holds no dynamic variables, so its slots are bound directly
 	for i := 0; i < len(symbols); i++ {
 		if symbols[i] == "&" {
 			rest := nodes[i:]
 			if i+1 < len(symbols) {
-				environment.Set(symbols[i+1], Type{List: &rest})
+				environment.Bind(slot(environment.names, symbols[i+1]), Type{List: &rest})
 			} else {
-				environment.Set("&", Type{List: &rest})
+				environment.Bind(slot(environment.names, "&"), Type{List: &rest})
 			}
 			break
 		} else {
 			if i < len(nodes) {
-				environment.Set(symbols[i], nodes[i])
+				environment.Bind(slot(environment.names, symbols[i]), nodes[i])
 			}
 		}
 	}
@@ -32,35 +127,269 @@ func NewEnvironment(outer *Environment, symbols []string, nodes []Type) *Environ
 	return environment
 }
 
+func (env *Environment) Bind(index int, node Type) {
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
+	env.slots[index], env.bound[index] = node, true
+}
+
+// Set binds symbol in env, or sets the root value of its dynamic variable.
 func (env *Environment) Set(symbol string, node Type) {
-	env.table[symbol] = node
+	if env.transparent {
+		env.outer.Set(symbol, node)
+	} else if current, ok := env.lookup(symbol); ok && current.IsVar() {
+		current.Var.SetRoot(node)
+	} else if i := slot(env.names, symbol); i >= 0 {
+		env.Bind(i, node)
+		env.generation.Add(1)
+	} else {
+		env.mutex.Lock()
+		defer env.mutex.Unlock()
+		if env.table == nil {
+			env.table = make(map[string]Type)
+		}
+		env.table[symbol] = node
+		env.generation.Add(1)
+	}
 }
 
-func (env *Environment) SetCallable(symbol string, callable func(...Type) Type) {
-	env.table[symbol] = Type{Callable: &callable, Symbol: &symbol}
+// Unset removes the binding of symbol from env itself.
+func (env *Environment) Unset(symbol string) {
+	if env.transparent {
+		env.outer.Unset(symbol)
+		return
+	}
+
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
+	if i := slot(env.names, symbol); i >= 0 {
+		env.slots[i], env.bound[i] = Type{}, false
+	}
+	delete(env.table, symbol)
+	delete(env.metadata, symbol)
+	env.generation.Add(1)
 }
 
-func (env *Environment) Find(symbol string) *Environment {
-	for key := range env.table {
-		if key == symbol {
-			return env
+// DefineDynamic binds symbol to a dynamic variable in the outermost
+// environment, or sets its root value if it's already one.
+func (env *Environment) DefineDynamic(symbol string, node Type) {
+	root := env.Root()
+	if current, ok := root.lookup(symbol); ok && current.IsVar() {
+		current.Var.SetRoot(node)
+		return
+	}
+
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	if root.table == nil {
+		root.table = make(map[string]Type)
+	}
+	root.table[symbol] = *NewVar(node)
+	root.generation.Add(1)
+}
+
+// Var returns the dynamic variable symbol resolves to, or nil.
+func (env *Environment) Var(symbol string) *Var {
+	if e := env.Find(symbol); e != nil {
+		if node, _ := e.lookup(symbol); node.IsVar() {
+			return node.Var
 		}
 	}
+	return nil
+}
+
+func (env *Environment) SetCallable(symbol string, callable func(...Type) Type) {
+	env.SetCallableWithBindings(symbol, func(_ *Bindings, args ...Type) Type {
+		return callable(args...)
+	})
+}
+
+// SetCallableWithBindings binds symbol to a builtin given the bindings of its
+// caller, e.g. to read dynamic variables or call functions.
+func (env *Environment) SetCallableWithBindings(symbol string, callable func(*Bindings, ...Type) Type) {
+	env.Set(symbol, Type{Callable: &callable, Symbol: &symbol})
+}
+
+// lookup returns the value bound to symbol in env itself.
+func (env *Environment) lookup(symbol string) (Type, bool) {
+	env.mutex.RLock()
+	defer env.mutex.RUnlock()
+	if i := slot(env.names, symbol); i >= 0 && env.bound[i] {
+		return env.slots[i], true
+	}
+	node, ok := env.table[symbol]
+	return node, ok
+}
 
-	if env.outer != nil {
-		return env.outer.Find(symbol)
+func (env *Environment) Find(symbol string) *Environment {
+	if name, ok := Unqualified(symbol); ok {
+		return env.Root().Find(name)
 	}
 
+	for e := env; e != nil; e = e.outer {
+		if _, ok := e.lookup(symbol); ok {
+			return e
+		}
+	}
 	return nil
 }
 
 func (env *Environment) Get(symbol string) Type {
+	return env.get(symbol, env.bindings)
+}
+
+// get returns the value of symbol, dereferencing dynamic variables with
+// bindings.
+func (env *Environment) get(symbol string, bindings *Bindings) Type {
+	if name, ok := Unqualified(symbol); ok {
+		return env.Root().get(name, bindings)
+	}
+
+	for e := env; e != nil; e = e.outer {
+		if node, ok := e.lookup(symbol); ok && node.IsVar() {
+			return node.Var.Get(bindings)
+		} else if ok {
+			return node
+		}
+	}
+	return *NewStringException(fmt.Sprintf("'%s' not found", symbol))
+}
+
+// Resolved returns the value of symbol, which the compiler resolved to the
+// slot at index of the environment depth levels out, or to a binding outside
+// of the environments it created when index is negative. It looks symbol up
+// when the slot isn't bound yet, or when `def!` bound symbols in between.
+func (env *Environment) Resolved(depth int, index int, symbol string) Type {
+	e := env
+	for i := 0; i < depth; i++ {
+		if e.hasTable() {
+			return env.Get(symbol)
+		}
+		e = e.outer
+	}
+
+	if index < 0 {
+		return e.get(symbol, env.bindings)
+	}
+	e.mutex.RLock()
+	node, bound := e.slots[index], e.bound[index]
+	e.mutex.RUnlock()
+	if bound {
+		return node
+	}
+	return env.Get(symbol)
+}
+
+// Global caches the binding of a symbol in the outermost environment, which
+// ResolvedGlobal looks up again only once the environment changed.
+type Global struct {
+	cached atomic.Pointer[cachedGlobal]
+}
+
+type cachedGlobal struct {
+	environment *Environment
+	generation  uint64
+	node        Type
+}
+
+// ResolvedGlobal returns the value of symbol, which the compiler resolved to a
+// binding outside of the depth environments it created, like Resolved.
+func (env *Environment) ResolvedGlobal(depth int, symbol string, global *Global) Type {
+	e := env
+	if name, ok := Unqualified(symbol); ok {
+		e, symbol = env.Root(), name
+	} else {
+		for i := 0; i < depth; i++ {
+			if e.hasTable() {
+				return env.Get(symbol)
+			}
+			e = e.outer
+		}
+	}
+	if e.outer != nil {
+		return e.get(symbol, env.bindings)
+	}
+
+	node := Type{}
+	if cached := global.cached.Load(); cached != nil && cached.environment == e && cached.generation == e.generation.Load() {
+		node = cached.node
+	} else {
+		// read before the lookup, so that a change during it invalidates it
+		generation, ok := e.generation.Load(), false
+		if node, ok = e.lookup(symbol); !ok {
+			return *NewStringException(fmt.Sprintf("'%s' not found", symbol))
+		}
+		global.cached.Store(&cachedGlobal{environment: e, generation: generation, node: node})
+	}
+	if node.IsVar() {
+		return node.Var.Get(env.bindings)
+	}
+	return node
+}
+
+func (env *Environment) hasTable() bool {
+	env.mutex.RLock()
+	defer env.mutex.RUnlock()
+	return len(env.table) != 0
+}
+
+func (env *Environment) Root() *Environment {
+	for env.outer != nil {
+		env = env.outer
+	}
+	return env
+}
+
+func (env *Environment) SetMetadata(symbol string, metadata Type) {
+	if env.transparent {
+		env.outer.SetMetadata(symbol, metadata)
+		return
+	}
+
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
+	if env.metadata == nil {
+		env.metadata = make(map[string]Type)
+	}
+	env.metadata[symbol] = metadata
+}
+
+func (env *Environment) GetMetadata(symbol string) Type {
+	if name, ok := Unqualified(symbol); ok {
+		return env.Root().GetMetadata(name)
+	}
+
 	if e := env.Find(symbol); e != nil {
-		for key, value := range e.table {
-			if key == symbol {
-				return value
+		e.mutex.RLock()
+		defer e.mutex.RUnlock()
+		if metadata, ok := e.metadata[symbol]; ok {
+			return metadata
+		}
+	}
+	return *NewNil()
+}
+
+// Symbols lists the symbols bound in env and its outer environments, sorted
+// and without duplicates.
+func (env *Environment) Symbols() []string {
+	seen := make(map[string]bool)
+	for e := env; e != nil; e = e.outer {
+		e.mutex.RLock()
+		for i, name := range e.names {
+			if e.bound[i] {
+				seen[name] = true
 			}
 		}
+		for key := range e.table {
+			seen[key] = true
+		}
+		e.mutex.RUnlock()
 	}
-	return *NewStringException(fmt.Sprintf("'%s' not found", symbol))
+
+	symbols := make([]string, 0, len(seen))
+	for symbol := range seen {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
 }
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -214,3 +215,132 @@ func Test_SetCallable_Should_Add_Native_Function_Binding_To_Environment(t *testi
 		t.Error("SetCallable() failed.")
 	}
 }
+
+func Test_Symbols_Should_Include_Outer_Environments(t *testing.T) {
+	outer := NewEnvironment(nil, []string{"b", "a"}, []Type{*NewNumber(1), *NewNumber(2)})
+	inner := NewEnvironment(outer, []string{"c", "a"}, []Type{*NewNumber(3), *NewNumber(4)})
+
+	if symbols := inner.Symbols(); !reflect.DeepEqual(symbols, []string{"a", "b", "c"}) {
+		t.Errorf("Symbols() failed: %v", symbols)
+	}
+}
+
+func Test_Metadata_Should_Belong_To_Bindings(t *testing.T) {
+	outer := NewEnvironment(nil, []string{"a"}, []Type{*NewNumber(1)})
+	inner := NewEnvironment(outer, []string{}, []Type{})
+
+	outer.SetMetadata("a", *NewString("doc"))
+	if metadata := inner.GetMetadata("a"); metadata.ToString(false) != "doc" {
+		t.Error("GetMetadata() should look up outer environments.")
+	}
+
+	inner.Set("a", *NewNumber(2))
+	if metadata := inner.GetMetadata("a"); !metadata.IsNil() {
+		t.Error("GetMetadata() should return the metadata of the innermost binding.")
+	}
+}
+
+func Test_Qualified_Symbols_Should_Skip_Local_Bindings(t *testing.T) {
+	outer := NewEnvironment(nil, []string{"a"}, []Type{*NewNumber(1)})
+	inner := NewEnvironment(outer, []string{"a"}, []Type{*NewNumber(2)})
+
+	if node := inner.Get("user/a"); node.ToString(true) != "1" {
+		t.Errorf("Get() should resolve qualified symbols globally, got %s.", node.ToString(true))
+	}
+	if inner.Find("user/a") != outer || inner.Find("user/b") != nil || inner.Find("user/") != nil {
+		t.Error("Find() failed.")
+	}
+}
+
+func Test_Frame_Slots(t *testing.T) {
+	if slots := Slots([]string{"a", "b", "a", "&", "c", "d"}); !reflect.DeepEqual(slots, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected slots %v.", slots)
+	}
+	if slots := Slots([]string{"a", "&"}); !reflect.DeepEqual(slots, []string{"a", "&"}) {
+		t.Errorf("Unexpected slots %v.", slots)
+	}
+
+	outer := NewEnvironment(nil, []string{"a"}, []Type{*NewNumber(1)})
+	frame := NewFrame(outer, []string{"a", "b"})
+	if node := frame.Resolved(0, 0, "a"); node.ToString(true) != "1" {
+		t.Errorf("An unbound slot should be looked up, got %s.", node.ToString(true))
+	}
+	frame.Bind(0, *NewNumber(2))
+	if node := frame.Resolved(0, 0, "a"); node.ToString(true) != "2" {
+		t.Errorf("Unexpected slot value %s.", node.ToString(true))
+	}
+	if node := NewFrame(frame, []string{}).Resolved(1, 0, "a"); node.ToString(true) != "2" {
+		t.Errorf("Unexpected slot value %s.", node.ToString(true))
+	}
+	if node := frame.Resolved(1, -1, "a"); node.ToString(true) != "1" {
+		t.Errorf("Unexpected outer value %s.", node.ToString(true))
+	}
+
+	frame.Set("c", *NewNumber(3))
+	inner := NewFrame(frame, []string{})
+	inner.Set("a", *NewNumber(4))
+	if node := inner.Resolved(1, 0, "a"); node.ToString(true) != "4" {
+		t.Errorf("A binding made by `def!` should shadow the slot, got %s.", node.ToString(true))
+	}
+	if symbols := inner.Symbols(); !reflect.DeepEqual(symbols, []string{"a", "c"}) {
+		t.Errorf("Unexpected symbols %v.", symbols)
+	}
+}
+
+func Test_Resolved_Globals_Are_Cached_Until_Changed(t *testing.T) {
+	root := NewEnvironment(nil, []string{"a"}, []Type{*NewNumber(1)})
+	root.Set("b", *NewNumber(2))
+	frame := NewFrame(root, []string{"x"})
+	a, b := &Global{}, &Global{}
+
+	for _, expected := range []string{"1", "1"} {
+		if node := frame.ResolvedGlobal(1, "a", a); node.ToString(true) != expected {
+			t.Errorf("(output) %s != %s (expected)", node.ToString(true), expected)
+		}
+	}
+	root.Set("a", *NewNumber(3))
+	root.Set("b", *NewNumber(4))
+	if node := frame.ResolvedGlobal(1, "a", a); node.ToString(true) != "3" {
+		t.Errorf("A changed slot should be looked up again, got %s.", node.ToString(true))
+	} else if node := frame.ResolvedGlobal(1, "user/b", b); node.ToString(true) != "4" {
+		t.Errorf("Unexpected global value %s.", node.ToString(true))
+	}
+	root.Unset("b")
+	if node := frame.ResolvedGlobal(1, "b", b); !node.IsException() {
+		t.Errorf("An unset global should be looked up again, got %s.", node.ToString(true))
+	}
+
+	root.DefineDynamic("*d*", *NewNumber(5))
+	d := &Global{}
+	frame.ResolvedGlobal(1, "*d*", d)
+	var none *Bindings
+	frame.SetBindings(none.Bind([]*Var{root.Var("*d*")}, []Type{*NewNumber(6)}))
+	if node := frame.ResolvedGlobal(1, "*d*", d); node.ToString(true) != "6" {
+		t.Errorf("A cached dynamic variable should still be bound, got %s.", node.ToString(true))
+	}
+
+	// globals aren't cached below `def!` bindings
+	frame.Set("a", *NewNumber(7))
+	if node := NewFrame(frame, []string{}).ResolvedGlobal(2, "a", a); node.ToString(true) != "7" {
+		t.Errorf("A binding made by `def!` should shadow the global, got %s.", node.ToString(true))
+	}
+}
+
+func Test_WithBindings_Should_Convey_Bindings_And_Define_Outside(t *testing.T) {
+	root := NewEnvironment(nil, []string{}, []Type{})
+	root.DefineDynamic("*x*", *NewNumber(1))
+	var none *Bindings
+	bound := root.WithBindings(none.Bind([]*Var{root.Var("*x*")}, []Type{*NewNumber(2)}))
+	frame := NewEnvironment(bound, []string{"a"}, []Type{*NewNumber(3)})
+
+	if value := frame.Get("*x*"); value.ToString(true) != "2" {
+		t.Errorf("Get() should have returned the bound value, got `%s`.", value.ToString(true))
+	} else if value := root.Get("*x*"); value.ToString(true) != "1" {
+		t.Errorf("Get() should have returned the root value, got `%s`.", value.ToString(true))
+	}
+
+	bound.Set("b", *NewNumber(4))
+	if root.Find("b") != root {
+		t.Error("Set() should have defined the symbol in the outer environment.")
+	}
+}
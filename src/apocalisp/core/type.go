@@ -19,10 +19,23 @@ type Type struct {
 	List      *[]Type
 	Vector    *[]Type
 	Hashmap   *map[HashmapKey]Type
-	Callable  *(func(...Type) Type)
+	Callable  *(func(*Bindings, ...Type) Type)
 	Function  *Function
-	Atom      **Type
+	Atom      *Atom
+	Port      *Port
+	Future    *Future
+	Channel   *Channel
+	Var       *Var
 	Metadata  *Type
+	Source    *Source
+}
+
+// Source is where the reader read a form from: its text, and the line and
+// column it starts at, both counted from 1.
+type Source struct {
+	Text   string
+	Line   int
+	Column int
 }
 
 func (node Type) ToString(readably bool) string {
@@ -80,6 +93,12 @@ func (node Type) ToString(readably bool) string {
 		return formatSequence(hashmapToSequence(node), "{", "}")
 	} else if node.IsAtom() {
 		return fmt.Sprintf("(atom %s)", node.AsAtom().ToString(readably))
+	} else if node.IsPort() {
+		return fmt.Sprintf("#<port %s>", node.AsPort().Name)
+	} else if node.IsFuture() {
+		return fmt.Sprintf("#<%s>", node.AsFuture().Name)
+	} else if node.IsChannel() {
+		return "#<channel>"
 	}
 	return ""
 }
@@ -135,6 +154,22 @@ func compare(first Type, second Type) bool {
 		return first.Callable == second.Callable
 	}
 
+	if first.IsPort() && second.IsPort() {
+		return first.Port == second.Port
+	}
+
+	if first.IsAtom() && second.IsAtom() {
+		return first.Atom == second.Atom
+	}
+
+	if first.IsFuture() && second.IsFuture() {
+		return first.Future == second.Future
+	}
+
+	if first.IsChannel() && second.IsChannel() {
+		return first.Channel == second.Channel
+	}
+
 	return false
 }
 
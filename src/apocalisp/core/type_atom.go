@@ -1,8 +1,30 @@
 package core
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Atom is a reference whose value is replaced atomically.
+type Atom struct {
+	value atomic.Pointer[Type]
+	// mutex guards the watches and the validator
+	mutex     sync.Mutex
+	watches   []Watch
+	validator *Type
+}
+
+// Watch is a function called with its key, the atom, and the old and new
+// values whenever the atom changes.
+type Watch struct {
+	Key      Type
+	Function Type
+}
+
 func NewAtom(value Type) *Type {
-	ptr := &value
-	return &Type{Atom: &ptr}
+	atom := &Atom{}
+	atom.value.Store(&value)
+	return &Type{Atom: atom}
 }
 
 func (node *Type) IsAtom() bool {
@@ -11,11 +33,81 @@ func (node *Type) IsAtom() bool {
 
 func (node *Type) AsAtom() Type {
 	if node.IsAtom() {
-		return **node.Atom
+		return *node.Atom.Load()
 	}
 	return *NewNil()
 }
 
 func (node *Type) SetAtom(value Type) {
-	*node.Atom = &value
+	node.Atom.Swap(value)
+}
+
+func (atom *Atom) Load() *Type {
+	return atom.value.Load()
+}
+
+// Swap sets the value of the atom, returning the previous one.
+func (atom *Atom) Swap(value Type) Type {
+	return *atom.value.Swap(&value)
+}
+
+// CompareAndSwap sets the value of the atom if it's still old, as returned by
+// Load.
+func (atom *Atom) CompareAndSwap(old *Type, value Type) bool {
+	return atom.value.CompareAndSwap(old, &value)
+}
+
+// CompareAndSet sets the value of the atom if it's equal to old.
+func (atom *Atom) CompareAndSet(old Type, value Type) bool {
+	for {
+		current := atom.Load()
+		if !current.Compare(old) {
+			return false
+		} else if atom.CompareAndSwap(current, value) {
+			return true
+		}
+	}
+}
+
+// AddWatch adds a watch, replacing the one with the same key.
+func (atom *Atom) AddWatch(key Type, function Type) {
+	atom.mutex.Lock()
+	defer atom.mutex.Unlock()
+	atom.watches = append(atom.removeWatch(key), Watch{Key: key, Function: function})
+}
+
+func (atom *Atom) RemoveWatch(key Type) {
+	atom.mutex.Lock()
+	defer atom.mutex.Unlock()
+	atom.watches = atom.removeWatch(key)
+}
+
+func (atom *Atom) removeWatch(key Type) []Watch {
+	watches := make([]Watch, 0, len(atom.watches))
+	for _, watch := range atom.watches {
+		if !watch.Key.Compare(key) {
+			watches = append(watches, watch)
+		}
+	}
+	return watches
+}
+
+func (atom *Atom) Watches() []Watch {
+	atom.mutex.Lock()
+	defer atom.mutex.Unlock()
+	return atom.watches
+}
+
+// SetValidator sets the function checking new values, or removes it when
+// validator is nil.
+func (atom *Atom) SetValidator(validator *Type) {
+	atom.mutex.Lock()
+	defer atom.mutex.Unlock()
+	atom.validator = validator
+}
+
+func (atom *Atom) Validator() *Type {
+	atom.mutex.Lock()
+	defer atom.mutex.Unlock()
+	return atom.validator
 }
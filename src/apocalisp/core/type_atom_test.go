@@ -0,0 +1,55 @@
+package core
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_Atom_CompareAndSet(t *testing.T) {
+	atom := NewAtom(*NewVector(*NewNumber(1))).Atom
+
+	if !atom.CompareAndSet(*NewList(*NewNumber(1)), *NewNumber(2)) {
+		t.Error("CompareAndSet() should have compared values by equality.")
+	}
+	if atom.CompareAndSet(*NewNumber(1), *NewNumber(3)) || atom.Load().ToString(true) != "2" {
+		t.Error("CompareAndSet() shouldn't have set a value that changed.")
+	}
+}
+
+func Test_Atom_CompareAndSwap_Concurrently(t *testing.T) {
+	atom := NewAtom(*NewNumber(0)).Atom
+
+	var group sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					old := atom.Load()
+					value, _ := old.AsNumber().Int64()
+					if atom.CompareAndSwap(old, *NewNumber(float64(value + 1))) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	group.Wait()
+
+	if value := atom.Load().ToString(true); value != "800" {
+		t.Errorf("CompareAndSwap() lost updates: `%s` != `800`.", value)
+	}
+}
+
+func Test_Atom_Watches(t *testing.T) {
+	atom := NewAtom(*NewNil()).Atom
+	atom.AddWatch(*NewSymbol(":a"), *NewNumber(1))
+	atom.AddWatch(*NewSymbol(":b"), *NewNumber(2))
+	atom.AddWatch(*NewSymbol(":a"), *NewNumber(3))
+	atom.RemoveWatch(*NewSymbol(":b"))
+
+	if watches := atom.Watches(); len(watches) != 1 || watches[0].Function.ToString(true) != "3" {
+		t.Errorf("AddWatch() should have replaced the watch with the same key, got %v.", watches)
+	}
+}
@@ -4,6 +4,6 @@ func (node *Type) IsCallable() bool {
 	return node.Callable != nil
 }
 
-func (node *Type) CallCallable(parameters ...Type) Type {
-	return (*node.Callable)(parameters...)
+func (node *Type) CallCallable(bindings *Bindings, parameters ...Type) Type {
+	return (*node.Callable)(bindings, parameters...)
 }
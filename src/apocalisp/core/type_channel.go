@@ -0,0 +1,147 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Channel passes values between goroutines. Unlike a Go channel, putting
+// into it once it's closed fails instead of panicking.
+type Channel struct {
+	values chan Type
+	closed chan struct{}
+	once   sync.Once
+}
+
+func NewChannel(size int) *Type {
+	return &Type{Channel: &Channel{values: make(chan Type, size), closed: make(chan struct{})}}
+}
+
+// NewTimeout returns a channel closing once timeout elapses.
+func NewTimeout(timeout time.Duration) *Type {
+	node := NewChannel(0)
+	time.AfterFunc(timeout, func() {
+		node.Channel.Close()
+	})
+	return node
+}
+
+func (node *Type) IsChannel() bool {
+	return node.Channel != nil
+}
+
+func (node *Type) AsChannel() *Channel {
+	return node.Channel
+}
+
+// Put waits until value is taken or buffered, and reports whether it was,
+// i.e. whether the channel wasn't closed or abort closed first.
+func (channel *Channel) Put(value Type, abort <-chan struct{}) bool {
+	if channel.IsClosed() {
+		return false
+	}
+
+	select {
+	case channel.values <- value:
+		return true
+	case <-channel.closed:
+		return false
+	case <-abort:
+		return false
+	}
+}
+
+// Take waits for a value, and reports whether there was one, i.e. whether the
+// channel wasn't closed and drained, nor abort closed first.
+func (channel *Channel) Take(abort <-chan struct{}) (Type, bool) {
+	select {
+	case value := <-channel.values:
+		return value, true
+	case <-channel.closed:
+		return channel.drain()
+	case <-abort:
+		return Type{}, false
+	}
+}
+
+// drain takes a value left in the buffer of a closed channel.
+func (channel *Channel) drain() (Type, bool) {
+	select {
+	case value := <-channel.values:
+		return value, true
+	default:
+		return Type{}, false
+	}
+}
+
+// Close closes the channel, and reports whether it wasn't already.
+func (channel *Channel) Close() bool {
+	closed := false
+	channel.once.Do(func() {
+		close(channel.closed)
+		closed = true
+	})
+	return closed
+}
+
+func (channel *Channel) IsClosed() bool {
+	select {
+	case <-channel.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Operation is a take from Channel, or a put of Value into it when Value
+// isn't nil.
+type Operation struct {
+	Channel *Channel
+	Value   *Type
+}
+
+// Select performs the first of operations able to proceed and returns its
+// index, or -1 if none is ready and block isn't set, or once abort is closed.
+func Select(operations []Operation, block bool, abort <-chan struct{}) (int, Type, bool) {
+	// like Put, a closed channel fails puts even with room in its buffer
+	for i, operation := range operations {
+		if operation.Value != nil && operation.Channel.IsClosed() {
+			return i, Type{}, false
+		}
+	}
+
+	// each operation has a case for itself and one for its channel closing
+	cases := make([]reflect.SelectCase, 0, 2*len(operations)+2)
+	for _, operation := range operations {
+		if operation.Value != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(operation.Channel.values), Send: reflect.ValueOf(*operation.Value)})
+		} else {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(operation.Channel.values)})
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(operation.Channel.closed)})
+	}
+	// a nil abort channel is never ready
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(abort)})
+	if !block {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+
+	chosen, received, _ := reflect.Select(cases)
+	if chosen >= 2*len(operations) {
+		return -1, Type{}, false
+	}
+
+	index, operation := chosen/2, operations[chosen/2]
+	if chosen%2 == 1 {
+		// closed
+		if operation.Value != nil {
+			return index, Type{}, false
+		}
+		value, ok := operation.Channel.drain()
+		return index, value, ok
+	} else if operation.Value != nil {
+		return index, Type{}, true
+	}
+	return index, received.Interface().(Type), true
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Channel_Close_Drains_Buffer(t *testing.T) {
+	channel := NewChannel(2).AsChannel()
+	channel.Put(*NewNumber(1), nil)
+	channel.Put(*NewNumber(2), nil)
+
+	if !channel.Close() || channel.Close() {
+		t.Error("Close() should have reported closing the channel once.")
+	}
+	if channel.Put(*NewNumber(3), nil) {
+		t.Error("Put() into a closed channel should have failed.")
+	}
+	for _, expected := range []string{"1", "2"} {
+		if value, ok := channel.Take(nil); !ok || value.ToString(true) != expected {
+			t.Errorf("Take() should have returned `%s`, got `%s`.", expected, value.ToString(true))
+		}
+	}
+	if _, ok := channel.Take(nil); ok {
+		t.Error("Take() from a drained channel should have failed.")
+	}
+}
+
+func Test_Channel_Select(t *testing.T) {
+	first, second := NewChannel(0).AsChannel(), NewChannel(1).AsChannel()
+	value := *NewString("put")
+
+	if index, _, _ := Select([]Operation{{Channel: first}}, false, nil); index != -1 {
+		t.Errorf("Select() should have returned -1 without ready operations, got %d.", index)
+	}
+	if index, _, ok := Select([]Operation{{Channel: first}, {Channel: second, Value: &value}}, true, nil); index != 1 || !ok {
+		t.Errorf("Select() should have put into the buffered channel, got %d.", index)
+	}
+	if index, taken, ok := Select([]Operation{{Channel: first}, {Channel: second}}, true, nil); index != 1 || !ok || taken.AsString() != "put" {
+		t.Errorf("Select() should have taken from the buffered channel, got %d.", index)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		first.Close()
+	}()
+	if index, _, ok := Select([]Operation{{Channel: first}}, true, nil); index != 0 || ok {
+		t.Error("Select() should have returned once the channel closed.")
+	}
+}
+
+func Test_Timeout_Closes(t *testing.T) {
+	channel := NewTimeout(time.Millisecond).AsChannel()
+	if _, ok := channel.Take(nil); ok || !channel.IsClosed() {
+		t.Error("A timeout channel should have closed without values.")
+	}
+}
+
+func Test_Channel_Aborts(t *testing.T) {
+	channel := NewChannel(0).AsChannel()
+
+	abort := make(chan struct{})
+	close(abort)
+	if channel.Put(*NewNumber(1), abort) {
+		t.Error("Put() should have failed once abort closed.")
+	}
+	if _, ok := channel.Take(abort); ok {
+		t.Error("Take() should have failed once abort closed.")
+	}
+	if index, _, _ := Select([]Operation{{Channel: channel}}, true, abort); index != -1 {
+		t.Errorf("Select() should have returned -1 once abort closed, got %d.", index)
+	}
+}
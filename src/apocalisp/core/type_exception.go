@@ -8,6 +8,13 @@ func NewStringException(message string) *Type {
 	return &Type{Exception: &Type{String: &message}}
 }
 
+// NewErrorException builds a hashmap exception with `:type`, `:message` and
+// the pairs in details.
+func NewErrorException(kind string, message string, details ...Type) *Type {
+	sequence := []Type{*NewSymbol(":type"), *NewSymbol(":" + kind), *NewSymbol(":message"), *NewString(message)}
+	return NewException(*NewHashmapFromSequence(append(sequence, details...)))
+}
+
 func (node *Type) IsException() bool {
 	return node.Exception != nil
 }
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"testing"
+)
+
+func Test_NewErrorException(t *testing.T) {
+	node := NewErrorException("io-error", "boom", *NewSymbol(":path"), *NewString("/tmp/x"))
+
+	if !node.IsException() || !node.AsException().IsHashmap() {
+		t.Fatal("NewErrorException() should create a hashmap exception.")
+	}
+
+	hashmap := node.AsException().AsHashmap()
+
+	if value := hashmap[NewHashmapKey(":type", true)]; !value.CompareSymbol(":io-error") {
+		t.Error("NewErrorException() failed to set `:type`.")
+	}
+
+	if value := hashmap[NewHashmapKey(":message", true)]; value.AsString() != "boom" {
+		t.Error("NewErrorException() failed to set `:message`.")
+	}
+
+	if value := hashmap[NewHashmapKey(":path", true)]; value.AsString() != "/tmp/x" {
+		t.Error("NewErrorException() failed to set details.")
+	}
+}
@@ -4,8 +4,11 @@ type Function struct {
 	IsMacro     bool
 	Params      []string
 	Body        Type
-	Callable    (func(...Type) Type)
-	Environment Environment
+	Callable    (func(*Bindings, ...Type) Type)
+	Environment *Environment
+	// Compiled is the body, and how calls bind the parameters, as compiled by
+	// the evaluator that created the function, if it compiles them
+	Compiled interface{}
 }
 
 func (node *Type) IsFunction() bool {
@@ -16,6 +19,6 @@ func (node *Type) IsMacroFunction() bool {
 	return node.Function != nil && node.Function.IsMacro
 }
 
-func (node *Type) CallFunction(parameters ...Type) Type {
-	return (node.Function.Callable)(parameters...)
+func (node *Type) CallFunction(bindings *Bindings, parameters ...Type) Type {
+	return (node.Function.Callable)(bindings, parameters...)
 }
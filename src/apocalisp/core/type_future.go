@@ -0,0 +1,89 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Future holds a value computed by a goroutine for `future`, or delivered to
+// a promise.
+type Future struct {
+	// Name is "future" or "promise".
+	Name      string
+	done      chan struct{}
+	once      sync.Once
+	value     Type
+	cancelled atomic.Bool
+}
+
+func NewFuture(name string) *Type {
+	return &Type{Future: &Future{Name: name, done: make(chan struct{})}}
+}
+
+func (node *Type) IsFuture() bool {
+	return node.Future != nil
+}
+
+func (node *Type) AsFuture() *Future {
+	return node.Future
+}
+
+// Deliver realizes the future with value, unless it's already realized. It
+// reports whether it did.
+func (future *Future) Deliver(value Type) bool {
+	delivered := false
+	future.once.Do(func() {
+		future.value, delivered = value, true
+		close(future.done)
+	})
+	return delivered
+}
+
+// Cancel realizes the future without a value, unless it's already realized.
+// It reports whether it did.
+func (future *Future) Cancel() bool {
+	cancelled := false
+	future.once.Do(func() {
+		future.cancelled.Store(true)
+		cancelled = true
+		close(future.done)
+	})
+	return cancelled
+}
+
+func (future *Future) IsRealized() bool {
+	select {
+	case <-future.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (future *Future) IsCancelled() bool {
+	return future.cancelled.Load()
+}
+
+// Wait returns the value once it's realized, or false once timeout elapses or
+// abort is closed. A negative timeout never elapses.
+func (future *Future) Wait(timeout time.Duration, abort <-chan struct{}) (Type, bool) {
+	if future.IsRealized() {
+		return future.value, true
+	}
+
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-future.done:
+		return future.value, true
+	case <-expired:
+		return Type{}, false
+	case <-abort:
+		return Type{}, false
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Future_Deliver(t *testing.T) {
+	future := NewFuture("promise").AsFuture()
+
+	if _, ok := future.Wait(time.Millisecond, nil); ok || future.IsRealized() {
+		t.Error("Wait() should have timed out before the value is delivered.")
+	}
+
+	go future.Deliver(*NewString("first"))
+	if value, ok := future.Wait(-1, nil); !ok || value.AsString() != "first" {
+		t.Errorf("Wait() should have returned the delivered value, got `%s`.", value.ToString(true))
+	}
+
+	if future.Deliver(*NewString("second")) {
+		t.Error("Deliver() should have kept the first value.")
+	}
+	if value, _ := future.Wait(0, nil); value.AsString() != "first" {
+		t.Errorf("Wait() should have returned the first value, got `%s`.", value.ToString(true))
+	}
+}
+
+func Test_Future_Cancel(t *testing.T) {
+	future := NewFuture("future").AsFuture()
+
+	if !future.Cancel() || !future.IsCancelled() || !future.IsRealized() {
+		t.Error("Cancel() should have realized the future as cancelled.")
+	}
+	if future.Cancel() || future.Deliver(*NewNil()) {
+		t.Error("A cancelled future shouldn't be realized again.")
+	}
+}
+
+func Test_Future_Wait_Aborts(t *testing.T) {
+	future := NewFuture("promise").AsFuture()
+
+	abort := make(chan struct{})
+	go close(abort)
+	if _, ok := future.Wait(-1, abort); ok || future.IsRealized() {
+		t.Error("Wait() should have returned once abort closed.")
+	}
+}
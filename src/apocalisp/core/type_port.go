@@ -0,0 +1,222 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Port wraps a Go reader or writer so Lisp code can stream data instead of
+// holding it in a single string.
+type Port struct {
+	Name string
+	// AutoFlush makes every write reach the underlying writer immediately,
+	// which is what interactive streams like stdout want.
+	AutoFlush bool
+	reader    *bufio.Reader
+	writer    *bufio.Writer
+	closer    io.Closer
+	text      *strings.Builder
+	closed    bool
+	// mutex serialises reads and writes, e.g. from futures printing to the
+	// same port
+	mutex sync.Mutex
+}
+
+// NewInputPort wraps reader. If reader is also an io.Closer, closing the port
+// closes it.
+func NewInputPort(name string, reader io.Reader) *Type {
+	port := &Port{Name: name, reader: bufio.NewReader(reader)}
+	if closer, ok := reader.(io.Closer); ok {
+		port.closer = closer
+	}
+	return &Type{Port: port}
+}
+
+// NewOutputPort wraps writer. If writer is also an io.Closer, closing the port
+// closes it.
+func NewOutputPort(name string, writer io.Writer) *Type {
+	port := &Port{Name: name, writer: bufio.NewWriter(writer)}
+	if closer, ok := writer.(io.Closer); ok {
+		port.closer = closer
+	}
+	return &Type{Port: port}
+}
+
+func NewStringInputPort(s string) *Type {
+	return NewInputPort("string", strings.NewReader(s))
+}
+
+// NewStringOutputPort collects everything written to it in memory, see
+// Port.Contents.
+func NewStringOutputPort() *Type {
+	text := &strings.Builder{}
+	node := NewOutputPort("string", text)
+	node.Port.text = text
+	return node
+}
+
+func (node *Type) IsPort() bool {
+	return node.Port != nil
+}
+
+func (node *Type) AsPort() *Port {
+	return node.Port
+}
+
+func (port *Port) IsInput() bool {
+	return port.reader != nil
+}
+
+func (port *Port) IsOutput() bool {
+	return port.writer != nil
+}
+
+func (port *Port) IsClosed() bool {
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+	return port.closed
+}
+
+// ReadLine returns the next line without its line terminator, or io.EOF once
+// the input is exhausted.
+func (port *Port) ReadLine() (string, error) {
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+
+	if err := port.check(port.IsInput()); err != nil {
+		return "", err
+	}
+
+	line, err := port.reader.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+}
+
+// ReadChar returns the next UTF-8 character, or io.EOF once the input is
+// exhausted.
+func (port *Port) ReadChar() (string, error) {
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+
+	if err := port.check(port.IsInput()); err != nil {
+		return "", err
+	}
+
+	r, _, err := port.reader.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	return string(r), nil
+}
+
+func (port *Port) Write(s string) error {
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+
+	if err := port.check(port.IsOutput()); err != nil {
+		return err
+	}
+
+	if _, err := port.writer.WriteString(s); err != nil {
+		return err
+	} else if port.AutoFlush {
+		return port.writer.Flush()
+	}
+	return nil
+}
+
+func (port *Port) Flush() error {
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+
+	if err := port.check(port.IsOutput()); err != nil {
+		return err
+	}
+	return port.writer.Flush()
+}
+
+// Close flushes pending output and releases the underlying resource. Closing a
+// port twice is a no-op.
+func (port *Port) Close() error {
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+
+	if port.closed {
+		return nil
+	}
+
+	var err error
+	if port.IsOutput() {
+		err = port.writer.Flush()
+	}
+	port.closed = true
+
+	if port.closer != nil {
+		if cerr := port.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (port *Port) Reader() io.Reader {
+	return portReader{port: port}
+}
+
+func (port *Port) Writer() io.Writer {
+	return portWriter{port: port}
+}
+
+// Contents returns what has been written so far to a port created by
+// NewStringOutputPort, and an empty string for any other port.
+func (port *Port) Contents() string {
+	if port.text == nil {
+		return ""
+	}
+	port.mutex.Lock()
+	defer port.mutex.Unlock()
+	port.writer.Flush()
+	return port.text.String()
+}
+
+func (port *Port) check(direction bool) error {
+	if port.closed {
+		return errors.New("port is closed")
+	} else if !direction {
+		if port.IsInput() {
+			return errors.New("port is not an output port")
+		}
+		return errors.New("port is not an input port")
+	}
+	return nil
+}
+
+type portReader struct {
+	port *Port
+}
+
+func (r portReader) Read(p []byte) (int, error) {
+	r.port.mutex.Lock()
+	defer r.port.mutex.Unlock()
+
+	if err := r.port.check(r.port.IsInput()); err != nil {
+		return 0, err
+	}
+	return r.port.reader.Read(p)
+}
+
+type portWriter struct {
+	port *Port
+}
+
+func (w portWriter) Write(p []byte) (int, error) {
+	if err := w.port.Write(string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
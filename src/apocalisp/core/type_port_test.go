@@ -0,0 +1,124 @@
+package core
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type closeRecorder struct {
+	strings.Builder
+	closed bool
+}
+
+func (recorder *closeRecorder) Close() error {
+	recorder.closed = true
+	return nil
+}
+
+func Test_Port_ReadLine(t *testing.T) {
+	port := NewInputPort("test", strings.NewReader("first\r\nsecond\nthird")).AsPort()
+
+	for _, expected := range []string{"first", "second", "third"} {
+		if line, err := port.ReadLine(); err != nil || line != expected {
+			t.Errorf("ReadLine() should have returned `%s`, got `%s`.", expected, line)
+		}
+	}
+
+	if _, err := port.ReadLine(); err != io.EOF {
+		t.Error("ReadLine() should have returned io.EOF.")
+	}
+}
+
+func Test_Port_ReadChar(t *testing.T) {
+	port := NewInputPort("test", strings.NewReader("aé")).AsPort()
+
+	if c, _ := port.ReadChar(); c != "a" {
+		t.Error("ReadChar() failed.")
+	}
+
+	if c, _ := port.ReadChar(); c != "é" {
+		t.Error("ReadChar() should read whole UTF-8 characters.")
+	}
+
+	if _, err := port.ReadChar(); err != io.EOF {
+		t.Error("ReadChar() should have returned io.EOF.")
+	}
+}
+
+func Test_Port_Write_Flush_Close(t *testing.T) {
+	recorder := &closeRecorder{}
+	port := NewOutputPort("test", recorder).AsPort()
+
+	if err := port.Write("abc"); err != nil {
+		t.Error(err)
+	}
+
+	if recorder.String() != "" {
+		t.Error("Write() should buffer output until flushed.")
+	}
+
+	if port.Flush(); recorder.String() != "abc" {
+		t.Error("Flush() failed.")
+	}
+
+	port.Write("def")
+	if port.Close(); recorder.String() != "abcdef" || !recorder.closed || !port.IsClosed() {
+		t.Error("Close() should flush and close the underlying writer.")
+	}
+
+	if err := port.Write("ghi"); err == nil {
+		t.Error("Write() should fail on a closed port.")
+	}
+
+	if err := port.Close(); err != nil {
+		t.Error("Closing a port twice should be a no-op.")
+	}
+}
+
+func Test_Port_Direction(t *testing.T) {
+	input := NewInputPort("in", strings.NewReader("")).AsPort()
+	output := NewOutputPort("out", &strings.Builder{}).AsPort()
+
+	if err := input.Write("x"); err == nil {
+		t.Error("Write() should fail on an input port.")
+	}
+
+	if _, err := output.ReadLine(); err == nil {
+		t.Error("ReadLine() should fail on an output port.")
+	}
+}
+
+func Test_String_Ports(t *testing.T) {
+	output := NewStringOutputPort().AsPort()
+	output.Write("abc")
+
+	if output.Contents() != "abc" {
+		t.Error("Contents() should return everything written so far.")
+	}
+
+	input := NewStringInputPort("x\ny").AsPort()
+	if line, _ := input.ReadLine(); line != "x" {
+		t.Error("NewStringInputPort() failed.")
+	}
+
+	if NewOutputPort("other", &strings.Builder{}).AsPort().Contents() != "" {
+		t.Error("Contents() should be empty for non-string ports.")
+	}
+}
+
+func Test_Port_Reader_And_Writer_Adapters(t *testing.T) {
+	input := NewStringInputPort("abc").AsPort()
+	if contents, err := io.ReadAll(input.Reader()); err != nil || string(contents) != "abc" {
+		t.Error("Reader() failed.")
+	}
+
+	output := NewStringOutputPort().AsPort()
+	if _, err := io.WriteString(output.Writer(), "def"); err != nil || output.Contents() != "def" {
+		t.Error("Writer() failed.")
+	}
+
+	if _, err := output.Reader().Read(make([]byte, 1)); err == nil {
+		t.Error("Reader() should fail on an output port.")
+	}
+}
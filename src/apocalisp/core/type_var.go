@@ -0,0 +1,99 @@
+package core
+
+import (
+	"sync/atomic"
+)
+
+// Var holds the root value of a dynamic variable, which `binding` overrides
+// for the evaluation of its body.
+type Var struct {
+	root atomic.Pointer[Type]
+}
+
+func NewVar(value Type) *Type {
+	v := &Var{}
+	v.root.Store(&value)
+	return &Type{Var: v}
+}
+
+func (node *Type) IsVar() bool {
+	return node.Var != nil
+}
+
+// Get returns the value bindings give the variable, or the root value.
+func (v *Var) Get(bindings *Bindings) Type {
+	if cell := bindings.cell(v); cell != nil {
+		return *cell.Load()
+	}
+	return *v.root.Load()
+}
+
+// Set changes the value bindings give the variable, or the root value.
+func (v *Var) Set(bindings *Bindings, value Type) {
+	if !v.SetBound(bindings, value) {
+		v.SetRoot(value)
+	}
+}
+
+// SetBound changes the value bindings give the variable, and reports whether
+// they give it one.
+func (v *Var) SetBound(bindings *Bindings, value Type) bool {
+	if cell := bindings.cell(v); cell != nil {
+		cell.Store(&value)
+		return true
+	}
+	return false
+}
+
+func (v *Var) SetRoot(value Type) {
+	v.root.Store(&value)
+}
+
+// Bindings are the values `binding` gives vars, handed from callers to the
+// functions they call. nil has no bindings.
+type Bindings struct {
+	values map[*Var]*atomic.Pointer[Type]
+	// the future evaluated with the bindings, which stops once it's cancelled
+	future *Future
+}
+
+func (bindings *Bindings) cell(v *Var) *atomic.Pointer[Type] {
+	if bindings == nil {
+		return nil
+	}
+	return bindings.values[v]
+}
+
+// Bind returns bindings giving vars values, on top of the ones bindings
+// give.
+func (bindings *Bindings) Bind(vars []*Var, values []Type) *Bindings {
+	bound := &Bindings{values: make(map[*Var]*atomic.Pointer[Type])}
+	if bindings != nil {
+		bound.future = bindings.future
+		for v, cell := range bindings.values {
+			bound.values[v] = cell
+		}
+	}
+	for i, v := range vars {
+		cell := &atomic.Pointer[Type]{}
+		cell.Store(&values[i])
+		bound.values[v] = cell
+	}
+	return bound
+}
+
+// InFuture returns the bindings for evaluating future with the values
+// bindings give.
+func (bindings *Bindings) InFuture(future *Future) *Bindings {
+	bound := &Bindings{future: future}
+	if bindings != nil {
+		bound.values = bindings.values
+	}
+	return bound
+}
+
+// IsCancelled reports whether the future evaluated with bindings was
+// cancelled.
+func (bindings *Bindings) IsCancelled() bool {
+	return bindings != nil && bindings.future != nil && bindings.future.IsCancelled()
+}
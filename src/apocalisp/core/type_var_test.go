@@ -0,0 +1,32 @@
+package core
+
+import (
+	"testing"
+)
+
+func Test_Var_Bindings(t *testing.T) {
+	v := NewVar(*NewNumber(1)).Var
+
+	var none *Bindings
+	outer := none.Bind([]*Var{v}, []Type{*NewNumber(2)})
+	inner := outer.Bind([]*Var{v}, []Type{*NewNumber(3)})
+	if value := v.Get(outer); value.ToString(true) != "2" {
+		t.Errorf("Get() should have returned the bound value, got `%s`.", value.ToString(true))
+	} else if value := v.Get(inner); value.ToString(true) != "3" {
+		t.Errorf("Get() should have returned the innermost value, got `%s`.", value.ToString(true))
+	} else if value := v.Get(none); value.ToString(true) != "1" {
+		t.Errorf("Get() should have returned the root value, got `%s`.", value.ToString(true))
+	}
+
+	if !v.SetBound(inner, *NewNumber(4)) || v.Get(inner).ToString(true) != "4" || v.Get(outer).ToString(true) != "2" {
+		t.Error("SetBound() should have changed the innermost bound value only.")
+	}
+	if v.SetBound(none, *NewNumber(5)) {
+		t.Error("SetBound() without bindings should have failed.")
+	}
+
+	v.Set(none, *NewNumber(6))
+	if value := v.Get(none); value.ToString(true) != "6" || v.Get(outer).ToString(true) != "2" {
+		t.Errorf("Set() without bindings should have changed the root value only, got `%s`.", value.ToString(true))
+	}
+}
@@ -1,10 +1,12 @@
 package core
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+)
 
 func Test_IsNumber_Returns_True_For_Integers(t *testing.T) {
-	val := int64(34)
-	node := Type{Integer: &val}
+	node := Type{Integer: big.NewInt(34)}
 
 	if !node.IsNumber() {
 		t.Error("IsNumber() should return true for integers.")
@@ -12,8 +14,7 @@ func Test_IsNumber_Returns_True_For_Integers(t *testing.T) {
 }
 
 func Test_IsNumber_Returns_True_For_Floats(t *testing.T) {
-	val := float64(34)
-	node := Type{Float: &val}
+	node := Type{Float: big.NewFloat(34)}
 
 	if !node.IsNumber() {
 		t.Error("IsNumber() should return true for floats.")
@@ -29,19 +30,17 @@ func Test_IsNumber_Returns_False_For_Other_Types(t *testing.T) {
 }
 
 func Test_AsNumber_Returns_Numeric_Value_For_Integers(t *testing.T) {
-	val := int64(34)
-	node := Type{Integer: &val}
+	node := Type{Integer: big.NewInt(34)}
 
-	if node.AsNumber() != 34.0 {
+	if node.AsNumber().Cmp(big.NewFloat(34.0)) != 0 {
 		t.Error("AsNumber() failed.")
 	}
 }
 
 func Test_AsNumber_Returns_Numeric_Value_For_Floats(t *testing.T) {
-	val := float64(34.5)
-	node := Type{Float: &val}
+	node := Type{Float: big.NewFloat(34.5)}
 
-	if node.AsNumber() != 34.5 {
+	if node.AsNumber().Cmp(big.NewFloat(34.5)) != 0 {
 		t.Error("AsNumber() failed.")
 	}
 }
@@ -49,29 +48,25 @@ func Test_AsNumber_Returns_Numeric_Value_For_Floats(t *testing.T) {
 func Test_AsNumber_Returns_0_For_Other_Types(t *testing.T) {
 	node := Type{}
 
-	if node.AsNumber() != 0 {
+	if node.AsNumber().Sign() != 0 {
 		t.Error("AsNumber() failed.")
 	}
 }
 
 func Test_CoerceNumber(t *testing.T) {
-	actualFloat64 := float64(23.34)
-	coercibleFloat64 := float64(15)
-	actualInteger64 := int64(34)
+	actualInteger := Type{Integer: big.NewInt(34)}
+	actualFloat := Type{Float: big.NewFloat(23.34)}
+	coercibleFloat := Type{Float: big.NewFloat(15)}
 
-	actualInteger := Type{Integer: &actualInteger64}
-	actualFloat := Type{Float: &actualFloat64}
-	coercibleFloat := Type{Float: &coercibleFloat64}
-
-	if actualInteger.CoerceNumber().AsInteger() != actualInteger64 {
+	if actualInteger.CoerceNumber().AsInteger().Cmp(big.NewInt(34)) != 0 {
 		t.Error("CoerceNumber() failed.")
 	}
 
-	if actualFloat.CoerceNumber().AsFloat() != actualFloat64 {
+	if coerced := actualFloat.CoerceNumber(); !coerced.IsFloat() || coerced.AsFloat().Cmp(big.NewFloat(23.34)) != 0 {
 		t.Error("CoerceNumber() failed.")
 	}
 
-	if coercibleFloat.CoerceNumber().AsInteger() != int64(15) {
+	if coerced := coercibleFloat.CoerceNumber(); !coerced.IsInteger() || coerced.AsInteger().Cmp(big.NewInt(15)) != 0 {
 		t.Error("CoerceNumber() failed.")
 	}
 }
@@ -2,16 +2,46 @@ package apocalisp
 
 import (
 	"apocalisp/core"
+	_ "embed"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/peterh/liner"
 )
 
+var gensymCounter uint64
+
+// gensym makes a fresh symbol name for macros to bind without capturing the
+// caller's symbols.
+func gensym(prefix string) string {
+	return fmt.Sprintf("%s%d", prefix, atomic.AddUint64(&gensymCounter, 1))
+}
+
+// prelude holds the functions and macros written in Lisp, e.g. `defn`.
+//
+//go:embed prelude.lisp
+var prelude string
+
+// unrestrictedBuiltins are left out of RestrictedEnvironment besides the file
+// system and process ones: they read files or evaluate code where the limits
+// don't follow, or wait for values nothing in a sandbox would deliver.
+var unrestrictedBuiltins = []string{"slurp", "readline", "eval", "open-input", "open-output", "load-file", "future-call", "go-call", "promise", "chan", "timeout"}
+
 func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environment) (*core.Type, error)) *core.Environment {
+	return newEnvironment(parser, eval, false)
+}
+
+// RestrictedEnvironment is DefaultEnvironment without the builtins reaching
+// outside of the interpreter, nor the standard streams.
+func RestrictedEnvironment(parser core.Parser, eval func(*core.Type, *core.Environment) (*core.Type, error)) *core.Environment {
+	return newEnvironment(parser, eval, true)
+}
+
+func newEnvironment(parser core.Parser, eval func(*core.Type, *core.Environment) (*core.Type, error), restricted bool) *core.Environment {
 	environment := core.NewEnvironment(nil, []string{}, []core.Type{})
 
 	environment.SetCallable("+", func(inputs ...core.Type) core.Type {
@@ -148,22 +178,22 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return core.Type{String: &concatenated}
 	})
 
-	environment.SetCallable("prn", func(args ...core.Type) core.Type {
+	environment.SetCallableWithBindings("prn", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
 		parts := make([]string, 0)
 		for _, arg := range args {
 			parts = append(parts, arg.ToString(true))
 		}
-		fmt.Println(strings.Join(parts, " "))
-		return *core.NewNil()
+		return writeLine(caller, "*out*", strings.Join(parts, " "))
 	})
 
-	environment.SetCallable("println", func(args ...core.Type) core.Type {
+	environment.SetCallableWithBindings("println", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
 		parts := make([]string, 0)
 		for _, arg := range args {
 			parts = append(parts, arg.ToString(false))
 		}
-		fmt.Println(strings.Join(parts, " "))
-		return *core.NewNil()
+		return writeLine(caller, "*out*", strings.Join(parts, " "))
 	})
 
 	environment.SetCallable("read-string", func(args ...core.Type) core.Type {
@@ -174,70 +204,19 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *core.NewNil()
 	})
 
-	environment.SetCallable("slurp", func(args ...core.Type) core.Type {
-		if len(args) >= 1 {
-			filepath := args[0].AsString()
-			if contents, err := ioutil.ReadFile(filepath); err == nil {
-				scontents := string(contents)
-				return core.Type{String: &scontents}
-			}
-		}
-		return *core.NewNil()
-	})
-
-	environment.SetCallable("atom", func(args ...core.Type) core.Type {
-		if len(args) >= 1 {
-			return *core.NewAtom(args[0])
-		}
-		return *core.NewNil()
-	})
-
-	environment.SetCallable("atom?", func(args ...core.Type) core.Type {
-		if len(args) >= 1 {
-			return *core.NewBoolean(args[0].IsAtom())
-		}
-		return *core.NewBoolean(false)
-	})
-
-	environment.SetCallable("deref", func(args ...core.Type) core.Type {
-		if len(args) >= 1 {
-			return args[0].AsAtom()
-		}
-		return *core.NewNil()
-	})
-
-	environment.SetCallable("reset!", func(args ...core.Type) core.Type {
-		if len(args) >= 2 {
-			if args[0].IsAtom() {
-				args[0].SetAtom(args[1])
-				return args[1]
-			}
+	environment.SetCallableWithBindings("slurp", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		filepath, exception := stringArgument("slurp", args, 0)
+		if exception != nil {
+			return *exception
 		}
-		return *core.NewNil()
-	})
-
-	environment.SetCallable("swap!", func(args ...core.Type) core.Type {
-		if len(args) >= 2 {
-			node, callable := args[0], args[1]
-			fargs := append([]core.Type{node.AsAtom()}, args[2:]...)
-
-			if node.IsAtom() && callable.IsCallable() {
-				result := callable.CallCallable(fargs...)
-				if !result.IsException() {
-					node.SetAtom(result)
-				}
-				return result
-			}
 
-			if node.IsAtom() && callable.IsFunction() {
-				result := callable.CallFunction(fargs...)
-				if !result.IsException() {
-					node.SetAtom(result)
-				}
-				return result
-			}
+		if contents, err := ioutil.ReadFile(resolvePath(caller, filepath)); err != nil {
+			return ioException(err)
+		} else {
+			scontents := string(contents)
+			return core.Type{String: &scontents}
 		}
-		return *core.NewNil()
 	})
 
 	environment.SetCallable("cons", func(args ...core.Type) core.Type {
@@ -323,14 +302,14 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *core.NewNil()
 	})
 
-	environment.SetCallable("map", func(args ...core.Type) core.Type {
+	environment.SetCallableWithBindings("map", func(bindings *core.Bindings, args ...core.Type) core.Type {
 		result := core.NewList()
 
 		if len(args) >= 2 && args[1].IsIterable() {
 			first, iterable := args[0], args[1].AsIterable()
 			if first.IsFunction() {
 				for _, e := range iterable {
-					if rval := first.CallFunction(e); rval.IsException() {
+					if rval := first.CallFunction(bindings, e); rval.IsException() {
 						return rval
 					} else {
 						result.Append(rval)
@@ -338,7 +317,7 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 				}
 			} else if first.IsCallable() {
 				for _, e := range iterable {
-					if rval := first.CallCallable(e); rval.IsException() {
+					if rval := first.CallCallable(bindings, e); rval.IsException() {
 						return rval
 					} else {
 						result.Append(rval)
@@ -350,7 +329,7 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *result
 	})
 
-	environment.SetCallable("apply", func(args ...core.Type) core.Type {
+	environment.SetCallableWithBindings("apply", func(bindings *core.Bindings, args ...core.Type) core.Type {
 		if len(args) >= 2 {
 			lastIndex := len(args) - 1
 			first, middle, last := args[0], args[1:lastIndex], args[lastIndex]
@@ -365,9 +344,9 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 				}
 
 				if first.IsFunction() {
-					return first.CallFunction(middle...)
+					return first.CallFunction(bindings, middle...)
 				} else if first.IsCallable() {
-					return first.CallCallable(middle...)
+					return first.CallCallable(bindings, middle...)
 				}
 			}
 		}
@@ -378,9 +357,10 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *core.NewHashmapFromSequence(args)
 	})
 
-	environment.SetCallable("eval", func(args ...core.Type) core.Type {
+	environment.SetCallableWithBindings("eval", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
 		if len(args) >= 1 {
-			if r, err := eval(&args[0], environment); err != nil {
+			if r, err := eval(&args[0], caller); err != nil {
 				return *core.NewStringException(err.Error())
 			} else {
 				return *r
@@ -438,6 +418,14 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *core.NewStringException("Provided value must be a symbol.")
 	})
 
+	environment.SetCallable("gensym", func(args ...core.Type) core.Type {
+		prefix := "G__"
+		if len(args) >= 1 {
+			prefix = args[0].ToString(false)
+		}
+		return *core.NewSymbol(gensym(prefix))
+	})
+
 	environment.SetCallable("vector", func(args ...core.Type) core.Type {
 		vec := *core.NewVector()
 		for _, e := range args {
@@ -555,16 +543,35 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *core.NewHashmap()
 	})
 
-	environment.SetCallable("readline", func(args ...core.Type) core.Type {
+	environment.SetCallableWithBindings("readline", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
 		if len(args) >= 1 && args[0].IsString() {
-			var input *core.Type
-			withLiner(func(state *liner.State) {
-				if line, err := state.Prompt(args[0].AsString()); err == nil {
-					input = core.NewString(line)
+			// line editing is only available when reading from the terminal
+			if in, stdin := caller.Get("*in*"), caller.Get("*stdin*"); in.Compare(stdin) {
+				var input *core.Type
+				withLiner(func(state *liner.State) {
+					if line, err := state.Prompt(args[0].AsString()); err == nil {
+						input = core.NewString(line)
+					}
+				})
+				if input != nil {
+					return *input
 				}
-			})
-			if input != nil {
-				return *input
+				return *core.NewNil()
+			}
+
+			out, exception := streamPort(caller, "*out*")
+			if exception != nil {
+				return *exception
+			} else if err := out.Write(args[0].AsString()); err != nil {
+				return ioException(err)
+			}
+
+			in, exception := streamPort(caller, "*in*")
+			if exception != nil {
+				return *exception
+			} else if line, err := in.ReadLine(); err == nil {
+				return *core.NewString(line)
 			}
 		}
 		return *core.NewNil()
@@ -664,5 +671,34 @@ func DefaultEnvironment(parser core.Parser, eval func(*core.Type, *core.Environm
 		return *core.NewNil()
 	})
 
+	if !restricted {
+		defineFileSystem(environment)
+	}
+	defineStreams(environment)
+	if !restricted {
+		defineProcesses(environment)
+		defineOperatingSystem(environment)
+	}
+	defineIntrospection(environment)
+	defineProfiling(environment)
+	defineConcurrency(environment)
+	defineChannels(environment)
+
+	environment.Set("*file*", *core.NewString("prelude.lisp"))
+	if err := runSource(prelude, environment, eval, parser); err != nil {
+		panic(fmt.Sprintf("Error while loading the prelude: %s", err.Error()))
+	}
+	environment.Set("*file*", *core.NewNil())
+
+	if restricted {
+		for _, symbol := range unrestrictedBuiltins {
+			environment.Unset(symbol)
+		}
+		for _, symbol := range []string{"*stdin*", "*stdout*", "*stderr*"} {
+			environment.Unset(symbol)
+		}
+		environment.Set("*in*", *core.NewStringInputPort(""))
+	}
+
 	return environment
 }
@@ -0,0 +1,159 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+func channelArgument(function string, args []core.Type, index int) (*core.Channel, *core.Type) {
+	if index >= len(args) || !args[index].IsChannel() {
+		exception := argumentException(function, fmt.Sprintf("argument %d must be a channel.", index+1))
+		return nil, &exception
+	}
+	return args[index].AsChannel(), nil
+}
+
+func durationArgument(function string, args []core.Type, index int) (time.Duration, *core.Type) {
+	if index >= len(args) || !args[index].IsNumber() {
+		exception := argumentException(function, fmt.Sprintf("argument %d must be a number of milliseconds.", index+1))
+		return 0, &exception
+	}
+	ms, _ := args[index].AsNumber().Float64()
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// operations reads the operations given to `alts!`: a channel to take from,
+// or a [channel value] vector to put value into it.
+func operations(node core.Type) ([]core.Operation, []core.Type, *core.Type) {
+	invalid := argumentException("alts!", "expects a vector of channels and [channel value] vectors.")
+	if !node.IsIterable() || len(node.AsIterable()) == 0 {
+		return nil, nil, &invalid
+	}
+
+	operations, channels := make([]core.Operation, 0), make([]core.Type, 0)
+	for _, port := range node.AsIterable() {
+		if port.IsChannel() {
+			operations, channels = append(operations, core.Operation{Channel: port.AsChannel()}), append(channels, port)
+		} else if port.IsVector() && len(port.AsIterable()) == 2 && port.AsIterable()[0].IsChannel() && !port.AsIterable()[1].IsNil() {
+			value := port.AsIterable()[1]
+			operations = append(operations, core.Operation{Channel: port.AsIterable()[0].AsChannel(), Value: &value})
+			channels = append(channels, port.AsIterable()[0])
+		} else {
+			return nil, nil, &invalid
+		}
+	}
+	return operations, channels, nil
+}
+
+func defineChannels(environment *core.Environment) {
+	// (chan size?) buffers size values
+	environment.SetCallable("chan", func(args ...core.Type) core.Type {
+		if len(args) == 0 {
+			return *core.NewChannel(0)
+		}
+
+		size, accuracy := int64(-1), big.Exact
+		if args[0].IsNumber() {
+			size, accuracy = args[0].AsNumber().Int64()
+		}
+		if size < 0 || accuracy != big.Exact {
+			return argumentException("chan", "the buffer size must be a non-negative integer.")
+		}
+		return *core.NewChannel(int(size))
+	})
+
+	environment.SetCallable("chan?", func(args ...core.Type) core.Type {
+		return *core.NewBoolean(len(args) >= 1 && args[0].IsChannel())
+	})
+
+	environment.SetCallable("timeout", func(args ...core.Type) core.Type {
+		if timeout, exception := durationArgument("timeout", args, 0); exception != nil {
+			return *exception
+		} else {
+			return *core.NewTimeout(timeout)
+		}
+	})
+
+	// nil can't be put, since taking from a closed channel returns it
+	put := func(args ...core.Type) core.Type {
+		if channel, exception := channelArgument("put!", args, 0); exception != nil {
+			return *exception
+		} else if len(args) < 2 || args[1].IsNil() {
+			return argumentException("put!", "can't put nil into a channel.")
+		} else {
+			ok := channel.Put(args[1], interruptions())
+			if !ok && isInterrupted() {
+				return *interruptedException()
+			}
+			return *core.NewBoolean(ok)
+		}
+	}
+	environment.SetCallable("put!", put)
+	environment.SetCallable(">!", put)
+
+	take := func(args ...core.Type) core.Type {
+		if channel, exception := channelArgument("take!", args, 0); exception != nil {
+			return *exception
+		} else if value, ok := channel.Take(interruptions()); ok {
+			return value
+		} else if isInterrupted() {
+			return *interruptedException()
+		}
+		return *core.NewNil()
+	}
+	environment.SetCallable("take!", take)
+	environment.SetCallable("<!", take)
+
+	environment.SetCallable("close!", func(args ...core.Type) core.Type {
+		if channel, exception := channelArgument("close!", args, 0); exception != nil {
+			return *exception
+		} else {
+			channel.Close()
+			return *core.NewNil()
+		}
+	})
+
+	// (alts! [ch [ch value] ...] :default value) returns [value channel] for the
+	// first operation ready, or [value :default] when none is.
+	environment.SetCallable("alts!", func(args ...core.Type) core.Type {
+		if len(args) < 1 {
+			return argumentException("alts!", "missing channels.")
+		}
+		operations, channels, exception := operations(args[0])
+		if exception != nil {
+			return *exception
+		}
+		defaultValue, nonBlocking := options(args[1:])[core.NewHashmapKey(":default", true)]
+
+		index, value, ok := core.Select(operations, !nonBlocking, interruptions())
+		if index < 0 && isInterrupted() {
+			return *interruptedException()
+		} else if index < 0 {
+			return *core.NewVector(defaultValue, *core.NewSymbol(":default"))
+		} else if operations[index].Value != nil {
+			value = *core.NewBoolean(ok)
+		} else if !ok {
+			value = *core.NewNil()
+		}
+		return *core.NewVector(value, channels[index])
+	})
+
+	// used by `go`, which wraps its body in a function: the channel returned
+	// receives the value of body, unless it's nil, then closes
+	environment.SetCallableWithBindings("go-call", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if exception := functionArgument("go-call", args, 0); exception != nil {
+			return *exception
+		}
+
+		result := core.NewChannel(1)
+		spawn(bindings, args[0], func(value core.Type) {
+			if !value.IsNil() {
+				result.AsChannel().Put(value, nil)
+			}
+			result.AsChannel().Close()
+		})
+		return *result
+	})
+}
@@ -0,0 +1,41 @@
+package apocalisp
+
+import (
+	"testing"
+)
+
+func Test_Channels(t *testing.T) {
+	Repl_Test(`(let* [c (chan 2)] (do (put! c 1) (>! c 2) [(take! c) (<! c)]))`, `[1 2]`, t)
+	Repl_Test(`(let* [c (chan)] (do (go (>! c :ping)) (<! c)))`, `:ping`, t)
+	Repl_Test(`(let* [c (chan 1)] (do (put! c 1) (close! c) [(put! c 2) (take! c) (take! c)]))`, `[false 1 nil]`, t)
+	Repl_Test(`[(chan? (chan)) (chan? 1)]`, `[true false]`, t)
+	Repl_Test(`(try* (put! (chan 1) nil) (catch* e (get e :type)))`, `:argument-error`, t)
+	Repl_Test(`(try* (chan -1) (catch* e (get e :type)))`, `:argument-error`, t)
+	Repl_Test(`(try* (take! 1) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Channels_Pipeline(t *testing.T) {
+	Repl_Test(`(let* [in (chan) out (chan)]
+	             (do (go (dotimes [i 5] (>! in i)) (close! in))
+	                 (go (let* [loop (fn* () (let* [x (<! in)] (if (nil? x) (close! out) (do (>! out (* x x)) (loop)))))] (loop)))
+	                 (let* [collect (fn* (acc) (let* [x (<! out)] (if (nil? x) acc (collect (conj acc x)))))] (collect []))))`, `[0 1 4 9 16]`, t)
+}
+
+func Test_Go(t *testing.T) {
+	Repl_Test(`(<! (go (+ 1 2)))`, `3`, t)
+	Repl_Test(`(let* [c (go nil)] [(<! c) (put! c 1)])`, `[nil false]`, t)
+	Repl_Test(`(try* (<! (go (throw "boom"))) (catch* e e))`, `"boom"`, t)
+}
+
+func Test_Alts(t *testing.T) {
+	Repl_Test(`(let* [a (chan 1) b (chan 1)] (do (put! b :b) (let* [r (alts! [a b])] [(first r) (= (nth r 1) b)])))`, `[:b true]`, t)
+	Repl_Test(`(let* [a (chan 1)] (let* [r (alts! [[a :x]])] [(first r) (= (nth r 1) a) (take! a)]))`, `[true true :x]`, t)
+	Repl_Test(`(let* [a (chan) t (timeout 10)] (let* [r (alts! [a t])] [(first r) (= (nth r 1) t)]))`, `[nil true]`, t)
+	Repl_Test(`(alts! [(chan)] :default :none)`, `[:none :default]`, t)
+	Repl_Test(`(let* [a (chan 1)] (do (close! a) (first (alts! [[a 1]]))))`, `false`, t)
+	Repl_Test(`(try* (alts! [1]) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Timeout(t *testing.T) {
+	Repl_Test(`(let* [start (time-ms)] (do (<! (timeout 20)) (>= (- (time-ms) start) 20)))`, `true`, t)
+}
@@ -0,0 +1,365 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"fmt"
+	"time"
+)
+
+// call calls a function or a builtin with args, and the bindings of the
+// caller.
+func call(bindings *core.Bindings, function core.Type, args ...core.Type) core.Type {
+	if function.IsFunction() {
+		return function.CallFunction(bindings, args...)
+	}
+	return function.CallCallable(bindings, args...)
+}
+
+// spawn calls function in a goroutine with bindings, then done with its
+// result, or with an exception if it panics.
+func spawn(bindings *core.Bindings, function core.Type, done func(core.Type)) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done(*core.NewStringException(fmt.Sprintf("%v", r)))
+			}
+		}()
+		done(call(bindings, function))
+	}()
+}
+
+func atomArgument(function string, args []core.Type) (*core.Atom, *core.Type) {
+	if len(args) < 1 || !args[0].IsAtom() {
+		exception := argumentException(function, "argument 1 must be an atom.")
+		return nil, &exception
+	}
+	return args[0].Atom, nil
+}
+
+func functionArgument(function string, args []core.Type, index int) *core.Type {
+	if index >= len(args) || !(args[index].IsFunction() || args[index].IsCallable()) {
+		exception := argumentException(function, fmt.Sprintf("argument %d must be a function.", index+1))
+		return &exception
+	}
+	return nil
+}
+
+// validate checks value with the validator of an atom, if it has one.
+func validate(bindings *core.Bindings, validator *core.Type, value core.Type) *core.Type {
+	if validator == nil {
+		return nil
+	}
+
+	if result := call(bindings, *validator, value); result.IsException() {
+		return &result
+	} else if result.IsNil() || result.CompareBoolean(false) {
+		exception := *core.NewErrorException("validation-error", "Invalid reference state.", *core.NewSymbol(":value"), value)
+		return &exception
+	}
+	return nil
+}
+
+// notify calls the watches of node once it changed from old to value,
+// returning the first exception one of them returns.
+func notify(bindings *core.Bindings, node core.Type, old core.Type, value core.Type) *core.Type {
+	for _, watch := range node.Atom.Watches() {
+		if result := call(bindings, watch.Function, watch.Key, node, old, value); result.IsException() {
+			return &result
+		}
+	}
+	return nil
+}
+
+func reset(bindings *core.Bindings, node core.Type, value core.Type) (core.Type, *core.Type) {
+	if exception := validate(bindings, node.Atom.Validator(), value); exception != nil {
+		return core.Type{}, exception
+	}
+	old := node.Atom.Swap(value)
+	return old, notify(bindings, node, old, value)
+}
+
+// swap applies function to the value of the atom node until no other
+// goroutine changed it meanwhile, and returns the old and new values.
+func swap(bindings *core.Bindings, node core.Type, function core.Type, args []core.Type) (core.Type, core.Type, *core.Type) {
+	for {
+		old := node.Atom.Load()
+		value := call(bindings, function, append([]core.Type{*old}, args...)...)
+		if value.IsException() {
+			return *old, value, &value
+		} else if exception := validate(bindings, node.Atom.Validator(), value); exception != nil {
+			return *old, value, exception
+		} else if node.Atom.CompareAndSwap(old, value) {
+			return *old, value, notify(bindings, node, *old, value)
+		}
+	}
+}
+
+func futureArgument(function string, args []core.Type) (*core.Future, *core.Type) {
+	if len(args) < 1 || !args[0].IsFuture() {
+		exception := argumentException(function, "argument 1 must be a future or a promise.")
+		return nil, &exception
+	}
+	return args[0].AsFuture(), nil
+}
+
+// derefFuture handles (deref f) and (deref f ms timeout-value).
+func derefFuture(args []core.Type) core.Type {
+	future := args[0].AsFuture()
+
+	timeout, timeoutValue := time.Duration(-1), *core.NewNil()
+	if len(args) >= 2 {
+		if !args[1].IsNumber() {
+			return argumentException("deref", "the timeout must be a number of milliseconds.")
+		}
+		ms, _ := args[1].AsNumber().Float64()
+		timeout = time.Duration(ms * float64(time.Millisecond))
+		if timeout < 0 {
+			timeout = 0
+		}
+		if len(args) >= 3 {
+			timeoutValue = args[2]
+		}
+	}
+
+	if value, ok := future.Wait(timeout, interruptions()); !ok {
+		if isInterrupted() {
+			return *interruptedException()
+		}
+		return timeoutValue
+	} else if future.IsCancelled() {
+		return *cancelledException(future.Name)
+	} else {
+		return value
+	}
+}
+
+func defineConcurrency(environment *core.Environment) {
+	// (atom value :validator f)
+	environment.SetCallableWithBindings("atom", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if len(args) < 1 {
+			return *core.NewNil()
+		}
+
+		atom := *core.NewAtom(args[0])
+		if validator, ok := optionValue(options(args[1:]), ":validator"); ok {
+			if exception := functionArgument("atom", []core.Type{validator}, 0); exception != nil {
+				return *exception
+			}
+			if exception := validate(bindings, &validator, args[0]); exception != nil {
+				return *exception
+			}
+			atom.Atom.SetValidator(&validator)
+		}
+		return atom
+	})
+
+	environment.SetCallable("atom?", func(args ...core.Type) core.Type {
+		if len(args) >= 1 {
+			return *core.NewBoolean(args[0].IsAtom())
+		}
+		return *core.NewBoolean(false)
+	})
+
+	environment.SetCallable("deref", func(args ...core.Type) core.Type {
+		if len(args) >= 1 && args[0].IsFuture() {
+			return derefFuture(args)
+		} else if len(args) >= 1 {
+			return args[0].AsAtom()
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("reset!", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if _, exception := atomArgument("reset!", args); exception != nil {
+			return *exception
+		} else if len(args) < 2 {
+			return argumentException("reset!", "missing value.")
+		} else if _, exception := reset(bindings, args[0], args[1]); exception != nil {
+			return *exception
+		}
+		return args[1]
+	})
+
+	environment.SetCallableWithBindings("reset-vals!", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if _, exception := atomArgument("reset-vals!", args); exception != nil {
+			return *exception
+		} else if len(args) < 2 {
+			return argumentException("reset-vals!", "missing value.")
+		} else if old, exception := reset(bindings, args[0], args[1]); exception != nil {
+			return *exception
+		} else {
+			return *core.NewVector(old, args[1])
+		}
+	})
+
+	environment.SetCallableWithBindings("swap!", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if _, exception := atomArgument("swap!", args); exception != nil {
+			return *exception
+		} else if exception := functionArgument("swap!", args, 1); exception != nil {
+			return *exception
+		} else if _, value, exception := swap(bindings, args[0], args[1], args[2:]); exception != nil {
+			return *exception
+		} else {
+			return value
+		}
+	})
+
+	environment.SetCallableWithBindings("swap-vals!", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if _, exception := atomArgument("swap-vals!", args); exception != nil {
+			return *exception
+		} else if exception := functionArgument("swap-vals!", args, 1); exception != nil {
+			return *exception
+		} else if old, value, exception := swap(bindings, args[0], args[1], args[2:]); exception != nil {
+			return *exception
+		} else {
+			return *core.NewVector(old, value)
+		}
+	})
+
+	// values are compared by equality, as with `=`
+	environment.SetCallableWithBindings("compare-and-set!", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		atom, exception := atomArgument("compare-and-set!", args)
+		if exception != nil {
+			return *exception
+		} else if len(args) < 3 {
+			return argumentException("compare-and-set!", "expects an atom, its expected value and a new value.")
+		} else if exception := validate(bindings, atom.Validator(), args[2]); exception != nil {
+			return *exception
+		} else if !atom.CompareAndSet(args[1], args[2]) {
+			return *core.NewBoolean(false)
+		} else if exception := notify(bindings, args[0], args[1], args[2]); exception != nil {
+			return *exception
+		}
+		return *core.NewBoolean(true)
+	})
+
+	// (add-watch atom key (fn* (key atom old new) ...))
+	environment.SetCallable("add-watch", func(args ...core.Type) core.Type {
+		if atom, exception := atomArgument("add-watch", args); exception != nil {
+			return *exception
+		} else if len(args) < 3 {
+			return argumentException("add-watch", "expects an atom, a key and a function.")
+		} else if exception := functionArgument("add-watch", args, 2); exception != nil {
+			return *exception
+		} else {
+			atom.AddWatch(args[1], args[2])
+			return args[0]
+		}
+	})
+
+	environment.SetCallable("remove-watch", func(args ...core.Type) core.Type {
+		if atom, exception := atomArgument("remove-watch", args); exception != nil {
+			return *exception
+		} else if len(args) < 2 {
+			return argumentException("remove-watch", "missing key.")
+		} else {
+			atom.RemoveWatch(args[1])
+			return args[0]
+		}
+	})
+
+	// nil removes the validator
+	environment.SetCallableWithBindings("set-validator!", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		atom, exception := atomArgument("set-validator!", args)
+		if exception != nil {
+			return *exception
+		} else if len(args) < 2 || args[1].IsNil() {
+			atom.SetValidator(nil)
+			return *core.NewNil()
+		} else if exception := functionArgument("set-validator!", args, 1); exception != nil {
+			return *exception
+		}
+
+		validator := args[1]
+		if exception := validate(bindings, &validator, *atom.Load()); exception != nil {
+			return *exception
+		}
+		atom.SetValidator(&validator)
+		return *core.NewNil()
+	})
+
+	environment.SetCallable("get-validator", func(args ...core.Type) core.Type {
+		if atom, exception := atomArgument("get-validator", args); exception != nil {
+			return *exception
+		} else if validator := atom.Validator(); validator != nil {
+			return *validator
+		}
+		return *core.NewNil()
+	})
+
+	// used by `future`, which wraps its body in a function
+	environment.SetCallableWithBindings("future-call", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		if len(args) < 1 || !(args[0].IsFunction() || args[0].IsCallable()) {
+			return argumentException("future-call", "argument 1 must be a function.")
+		}
+
+		future := core.NewFuture("future")
+		spawn(bindings.InFuture(future.AsFuture()), args[0], func(value core.Type) {
+			future.AsFuture().Deliver(value)
+		})
+		return *future
+	})
+
+	environment.SetCallable("promise", func(args ...core.Type) core.Type {
+		return *core.NewFuture("promise")
+	})
+
+	environment.SetCallable("deliver", func(args ...core.Type) core.Type {
+		promise, exception := futureArgument("deliver", args)
+		if exception != nil {
+			return *exception
+		} else if promise.Name != "promise" {
+			return argumentException("deliver", "argument 1 must be a promise.")
+		} else if len(args) < 2 {
+			return argumentException("deliver", "missing value.")
+		}
+
+		// like Clojure, nil tells that the promise was already delivered
+		if promise.Deliver(args[1]) {
+			return args[0]
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallable("future?", func(args ...core.Type) core.Type {
+		return *core.NewBoolean(len(args) >= 1 && args[0].IsFuture() && args[0].AsFuture().Name == "future")
+	})
+
+	environment.SetCallable("promise?", func(args ...core.Type) core.Type {
+		return *core.NewBoolean(len(args) >= 1 && args[0].IsFuture() && args[0].AsFuture().Name == "promise")
+	})
+
+	environment.SetCallable("realized?", func(args ...core.Type) core.Type {
+		if future, exception := futureArgument("realized?", args); exception != nil {
+			return *exception
+		} else {
+			return *core.NewBoolean(future.IsRealized())
+		}
+	})
+
+	environment.SetCallable("future-done?", func(args ...core.Type) core.Type {
+		if future, exception := futureArgument("future-done?", args); exception != nil {
+			return *exception
+		} else {
+			return *core.NewBoolean(future.IsRealized())
+		}
+	})
+
+	// compiled code running in the goroutine stops at its next step, and
+	// `deref` returns right away
+	environment.SetCallable("future-cancel", func(args ...core.Type) core.Type {
+		if future, exception := futureArgument("future-cancel", args); exception != nil {
+			return *exception
+		} else {
+			return *core.NewBoolean(future.Cancel())
+		}
+	})
+
+	environment.SetCallable("future-cancelled?", func(args ...core.Type) core.Type {
+		if future, exception := futureArgument("future-cancelled?", args); exception != nil {
+			return *exception
+		} else {
+			return *core.NewBoolean(future.IsCancelled())
+		}
+	})
+}
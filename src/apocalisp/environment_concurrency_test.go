@@ -0,0 +1,91 @@
+package apocalisp
+
+import (
+	"apocalisp/parser"
+	"testing"
+	"time"
+)
+
+func Test_Future(t *testing.T) {
+	Repl_Test(`@(future (+ 1 2))`, `3`, t)
+	Repl_Test(`(let* [f (future (do (def! n 10) (* n n)))] [(future? f) @f @f])`, `[true 100 100]`, t)
+	Repl_Test(`(apply + (map deref (map (fn* (n) (future (* n n))) [1 2 3 4])))`, `30`, t)
+	Repl_Test(`(try* @(future (throw "boom")) (catch* e e))`, `"boom"`, t)
+	Repl_Test(`(deref (future-call (fn* () :called)))`, `:called`, t)
+	Repl_Test(`(try* (future-call 1) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Future_Done_And_Cancel(t *testing.T) {
+	Repl_Test(`(let* [f (future 1)] (do @f (future-done? f)))`, `true`, t)
+	Repl_Test(`(let* [p (promise) f (future @p)] (do (deref f 10 nil) (future-done? f)))`, `false`, t)
+	Repl_Test(`(let* [p (promise) f (future @p)] [(future-cancel f) (future-cancel f) (future-cancelled? f) (future-done? f)])`, `[true false true true]`, t)
+	Repl_Test(`(let* [p (promise) f (future @p)] (do (future-cancel f) (try* @f (catch* e (get e :type)))))`, `:cancelled`, t)
+	Repl_Test(`(let* [f (future 1)] (do @f [(future-cancel f) (future-cancelled? f)]))`, `[false false]`, t)
+}
+
+func Test_Future_Cancel_Stops_Body(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	rep := func(in string) string {
+		out, err := Rep(in, environment, Evaluate, parser.Parser{})
+		if err != nil {
+			t.Fatalf("%s: %s", in, err.Error())
+		}
+		return out
+	}
+
+	rep(`(do (def! a (atom 0)) (def! spin (fn* () (do (swap! a + 1) (spin)))) (def! f (future (spin))))`)
+	time.Sleep(20 * time.Millisecond)
+	rep(`(future-cancel f)`)
+	time.Sleep(20 * time.Millisecond)
+	if before := rep(`@a`); before == "0" {
+		t.Errorf("the future didn't run.")
+	} else if time.Sleep(50 * time.Millisecond); rep(`@a`) != before {
+		t.Errorf("the future kept running once cancelled.")
+	}
+}
+
+func Test_Promise(t *testing.T) {
+	Repl_Test(`(let* [p (promise)] (do (deliver p 42) @p))`, `42`, t)
+	Repl_Test(`(let* [p (promise)] [(promise? p) (realized? p) (= p (deliver p 1)) (deliver p 2) (realized? p) @p])`, `[true false true nil true 1]`, t)
+	Repl_Test(`(let* [p (promise) f (future (+ @p 1))] (do (deliver p 41) @f))`, `42`, t)
+	Repl_Test(`(try* (deliver (future 1) 2) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Deref_Timeout(t *testing.T) {
+	Repl_Test(`(deref (promise) 10 :timed-out)`, `:timed-out`, t)
+	Repl_Test(`(deref (promise) 0)`, `nil`, t)
+	Repl_Test(`(deref (future 1) 1000 :timed-out)`, `1`, t)
+	Repl_Test(`(try* (deref (promise) "10") (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Futures_Define_Concurrently(t *testing.T) {
+	Repl_Test(`(do (def! fs (map (fn* (n) (future (do (def! x n) (str "v" n)))) [1 2 3 4 5 6 7 8])) (map deref fs))`, `("v1" "v2" "v3" "v4" "v5" "v6" "v7" "v8")`, t)
+	Repl_Test(`(count (seq (with-out-str (map deref (map (fn* (n) (future (println n))) [1 2 3 4 5 6 7 8])))))`, `16`, t)
+}
+
+func Test_Atom_Updates(t *testing.T) {
+	Repl_Test(`(let* [a (atom 1)] [(reset-vals! a 2) (swap-vals! a + 10) @a])`, `[[1 2] [2 12] 12]`, t)
+	Repl_Test(`(let* [a (atom [1])] [(compare-and-set! a [1] [2]) (compare-and-set! a [1] [3]) @a])`, `[true false [2]]`, t)
+	Repl_Test(`(let* [a (atom 1)] (do (try* (swap! a (fn* (x) (throw "no"))) (catch* e e)) @a))`, `1`, t)
+	Repl_Test(`(try* (swap! 1 +) (catch* e (get e :type)))`, `:argument-error`, t)
+	Repl_Test(`(try* (swap! (atom 1) 2) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Atom_Swap_Retries_On_Conflict(t *testing.T) {
+	Repl_Test(`(let* [a (atom 0)] (do (map deref (map (fn* (n) (future (dotimes [i 100] (swap! a + 1)))) [1 2 3 4 5 6 7 8])) @a))`, `800`, t)
+}
+
+func Test_Atom_Watches(t *testing.T) {
+	Repl_Test(`(let* [a (atom 1) log (atom [])] (do (add-watch a :log (fn* (k r old new) (swap! log conj [k (= r a) old new]))) (swap! a + 1) (reset! a 5) @log))`, `[[:log true 1 2] [:log true 2 5]]`, t)
+	Repl_Test(`(let* [a (atom 1) log (atom [])] (do (add-watch a :log (fn* (k r old new) (swap! log conj new))) (remove-watch a :log) (reset! a 2) @log))`, `[]`, t)
+	Repl_Test(`(let* [a (atom 1) log (atom [])] (do (add-watch a :k (fn* (k r old new) (swap! log conj 1))) (add-watch a :k (fn* (k r old new) (swap! log conj 2))) (reset! a 2) @log))`, `[2]`, t)
+	Repl_Test(`(let* [a (atom 1) log (atom [])] (do (add-watch a :k (fn* (k r old new) (swap! log conj new))) (compare-and-set! a 0 2) (compare-and-set! a 1 3) @log))`, `[3]`, t)
+}
+
+func Test_Atom_Validators(t *testing.T) {
+	Repl_Test(`(let* [a (atom 1 :validator number?)] (do (try* (reset! a "x") (catch* e (get e :type))) @a))`, `1`, t)
+	Repl_Test(`(try* (atom "x" :validator number?) (catch* e (get e :type)))`, `:validation-error`, t)
+	Repl_Test(`(let* [a (atom 1)] (do (set-validator! a (fn* (x) (> x 0))) [(try* (swap! a - 5) (catch* e (get e :value))) @a]))`, `[-4 1]`, t)
+	Repl_Test(`(let* [a (atom -1)] [(try* (set-validator! a (fn* (x) (> x 0))) (catch* e (get e :type))) (get-validator a)])`, `[:validation-error nil]`, t)
+	Repl_Test(`(let* [a (atom 1)] (do (set-validator! a number?) (set-validator! a nil) (reset! a "x")))`, `"x"`, t)
+}
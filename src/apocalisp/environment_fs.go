@@ -0,0 +1,288 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ioException converts a Go error into an `:io-error` exception, with the
+// `:op`, `:path` and `:reason` of path errors.
+func ioException(err error) core.Type {
+	details := make([]core.Type, 0)
+
+	var pathError *fs.PathError
+	var linkError *os.LinkError
+	if errors.As(err, &pathError) {
+		details = append(details, *core.NewSymbol(":op"), *core.NewString(pathError.Op))
+		details = append(details, *core.NewSymbol(":path"), *core.NewString(pathError.Path))
+	} else if errors.As(err, &linkError) {
+		details = append(details, *core.NewSymbol(":op"), *core.NewString(linkError.Op))
+		details = append(details, *core.NewSymbol(":path"), *core.NewString(linkError.Old))
+		details = append(details, *core.NewSymbol(":target"), *core.NewString(linkError.New))
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		details = append(details, *core.NewSymbol(":reason"), *core.NewSymbol(":not-found"))
+	} else if errors.Is(err, fs.ErrExist) {
+		details = append(details, *core.NewSymbol(":reason"), *core.NewSymbol(":exists"))
+	} else if errors.Is(err, fs.ErrPermission) {
+		details = append(details, *core.NewSymbol(":reason"), *core.NewSymbol(":permission"))
+	}
+
+	return *core.NewErrorException("io-error", err.Error(), details...)
+}
+
+func argumentException(function string, message string) core.Type {
+	return *core.NewErrorException("argument-error", fmt.Sprintf("`%s`: %s", function, message), *core.NewSymbol(":function"), *core.NewString(function))
+}
+
+func stringArgument(function string, args []core.Type, index int) (string, *core.Type) {
+	if index >= len(args) || !args[index].IsString() {
+		exception := argumentException(function, fmt.Sprintf("argument %d must be a string.", index+1))
+		return "", &exception
+	}
+	return args[index].AsString(), nil
+}
+
+// options reads trailing keyword/value pairs, e.g. `:append true`. A last
+// keyword without a value is a flag, e.g. `(mkdir path :parents)`.
+func options(args []core.Type) map[core.HashmapKey]core.Type {
+	if len(args)%2 == 1 && args[len(args)-1].IsKeyword() {
+		args = append(append([]core.Type{}, args...), *core.NewBoolean(true))
+	}
+	return core.NewHashmapFromSequence(args).AsHashmap()
+}
+
+func optionEnabled(options map[core.HashmapKey]core.Type, keyword string) bool {
+	value, ok := options[core.NewHashmapKey(keyword, true)]
+	return ok && !value.IsNil() && !value.CompareBoolean(false)
+}
+
+func optionString(options map[core.HashmapKey]core.Type, keyword string) string {
+	value := options[core.NewHashmapKey(keyword, true)]
+	return value.AsString()
+}
+
+// temporaryDirectory is the `:dir` option resolved against `*cwd*`, or the
+// system's temporary directory.
+func temporaryDirectory(environment *core.Environment, args []core.Type) string {
+	if dir := optionString(options(args), ":dir"); dir != "" {
+		return resolvePath(environment, dir)
+	}
+	return ""
+}
+
+func fileInfo(info fs.FileInfo) core.Type {
+	return *core.NewHashmapFromSequence([]core.Type{
+		*core.NewSymbol(":name"), *core.NewString(info.Name()),
+		*core.NewSymbol(":size"), *core.NewNumber(float64(info.Size())),
+		*core.NewSymbol(":mtime"), *core.NewNumber(float64(info.ModTime().UnixNano() / 1e6)),
+		*core.NewSymbol(":mode"), *core.NewString(info.Mode().String()),
+		*core.NewSymbol(":directory?"), *core.NewBoolean(info.IsDir()),
+	})
+}
+
+func defineFileSystem(environment *core.Environment) {
+	environment.SetCallableWithBindings("spit", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("spit", args, 0)
+		if exception != nil {
+			return *exception
+		} else if len(args) < 2 {
+			return argumentException("spit", "missing content.")
+		}
+
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if optionEnabled(options(args[2:]), ":append") {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+
+		file, err := os.OpenFile(resolvePath(caller, path), flags, 0666)
+		if err != nil {
+			return ioException(err)
+		}
+		defer file.Close()
+
+		if _, err := file.WriteString(args[1].ToString(false)); err != nil {
+			return ioException(err)
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("file-exists?", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("file-exists?", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if _, err := os.Stat(resolvePath(caller, path)); err == nil {
+			return *core.NewBoolean(true)
+		} else if errors.Is(err, fs.ErrNotExist) {
+			return *core.NewBoolean(false)
+		} else {
+			return ioException(err)
+		}
+	})
+
+	environment.SetCallableWithBindings("directory?", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("directory?", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if info, err := os.Stat(resolvePath(caller, path)); err == nil {
+			return *core.NewBoolean(info.IsDir())
+		} else if errors.Is(err, fs.ErrNotExist) {
+			return *core.NewBoolean(false)
+		} else {
+			return ioException(err)
+		}
+	})
+
+	environment.SetCallableWithBindings("list-dir", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("list-dir", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		entries, err := os.ReadDir(resolvePath(caller, path))
+		if err != nil {
+			return ioException(err)
+		}
+
+		names := *core.NewList()
+		for _, entry := range entries {
+			names.Append(*core.NewString(entry.Name()))
+		}
+		return names
+	})
+
+	environment.SetCallableWithBindings("mkdir", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("mkdir", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		var err error
+		if optionEnabled(options(args[1:]), ":parents") {
+			err = os.MkdirAll(resolvePath(caller, path), 0777)
+		} else {
+			err = os.Mkdir(resolvePath(caller, path), 0777)
+		}
+
+		if err != nil {
+			return ioException(err)
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("delete-file", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("delete-file", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if optionEnabled(options(args[1:]), ":recursive") {
+			// RemoveAll ignores missing paths, so check first to keep errors consistent.
+			if _, err := os.Lstat(resolvePath(caller, path)); err != nil {
+				return ioException(err)
+			} else if err := os.RemoveAll(resolvePath(caller, path)); err != nil {
+				return ioException(err)
+			}
+		} else if err := os.Remove(resolvePath(caller, path)); err != nil {
+			return ioException(err)
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("rename-file", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		source, exception := stringArgument("rename-file", args, 0)
+		if exception != nil {
+			return *exception
+		}
+		target, exception := stringArgument("rename-file", args, 1)
+		if exception != nil {
+			return *exception
+		}
+
+		if err := os.Rename(resolvePath(caller, source), resolvePath(caller, target)); err != nil {
+			return ioException(err)
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("file-info", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("file-info", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		info, err := os.Stat(resolvePath(caller, path))
+		if err != nil {
+			return ioException(err)
+		}
+		return fileInfo(info)
+	})
+
+	environment.SetCallableWithBindings("glob", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		pattern, exception := stringArgument("glob", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		matches, err := globPaths(caller, pattern)
+		if errors.Is(err, filepath.ErrBadPattern) {
+			return argumentException("glob", fmt.Sprintf("invalid pattern '%s'.", pattern))
+		} else if err != nil {
+			return ioException(err)
+		}
+
+		paths := *core.NewList()
+		for _, match := range matches {
+			paths.Append(*core.NewString(match))
+		}
+		return paths
+	})
+
+	environment.SetCallableWithBindings("temp-file", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		pattern, opts := "apocalisp-*", args
+		if len(args) >= 1 && args[0].IsString() {
+			pattern, opts = args[0].AsString(), args[1:]
+		}
+
+		file, err := os.CreateTemp(temporaryDirectory(caller, opts), pattern)
+		if err != nil {
+			return ioException(err)
+		}
+		defer file.Close()
+
+		return *core.NewString(file.Name())
+	})
+
+	environment.SetCallableWithBindings("temp-dir", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		pattern, opts := "apocalisp-*", args
+		if len(args) >= 1 && args[0].IsString() {
+			pattern, opts = args[0].AsString(), args[1:]
+		}
+
+		path, err := os.MkdirTemp(temporaryDirectory(caller, opts), pattern)
+		if err != nil {
+			return ioException(err)
+		}
+		return *core.NewString(path)
+	})
+}
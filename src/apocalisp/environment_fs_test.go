@@ -0,0 +1,84 @@
+package apocalisp
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Spit_And_Slurp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	Repl_Test(fmt.Sprintf(`(do (spit "%s" "abc") (slurp "%s"))`, path, path), `"abc"`, t)
+	Repl_Test(fmt.Sprintf(`(do (spit "%s" "abc") (spit "%s" "def" :append true) (slurp "%s"))`, path, path, path), `"abcdef"`, t)
+	Repl_Test(fmt.Sprintf(`(do (spit "%s" "abc") (spit "%s" "def") (slurp "%s"))`, path, path, path), `"def"`, t)
+}
+
+func Test_Slurp_Surfaces_Structured_Exceptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.txt")
+
+	Repl_Test(fmt.Sprintf(`(try* (slurp "%s") (catch* e (get e :reason)))`, path), `:not-found`, t)
+	Repl_Test(fmt.Sprintf(`(try* (slurp "%s") (catch* e (get e :type)))`, path), `:io-error`, t)
+	Repl_Test(fmt.Sprintf(`(try* (slurp "%s") (catch* e (= (get e :path) "%s")))`, path, path), `true`, t)
+	Repl_Test(`(try* (slurp 1) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_File_Predicates(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "file.txt")
+
+	Repl_Test(fmt.Sprintf(`(file-exists? "%s")`, path), `false`, t)
+	Repl_Test(fmt.Sprintf(`(do (spit "%s" "") (file-exists? "%s"))`, path, path), `true`, t)
+	Repl_Test(fmt.Sprintf(`(directory? "%s")`, path), `false`, t)
+	Repl_Test(fmt.Sprintf(`(directory? "%s")`, directory), `true`, t)
+}
+
+func Test_Directories(t *testing.T) {
+	// the files are changed, so each evaluator gets its own
+	for name, eval := range evaluators {
+		directory := t.TempDir()
+		nested := filepath.Join(directory, "a", "b")
+
+		Evaluator_Test(name, eval, fmt.Sprintf(`(try* (mkdir "%s") (catch* e (get e :reason)))`, nested), `:not-found`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (mkdir "%s" :parents true) (directory? "%s"))`, nested, nested), `true`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (spit "%s/z" "") (list-dir "%s"))`, directory, directory), `("a" "z")`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(count (glob "%s/*"))`, directory), `2`, t)
+		Evaluator_Test(name, eval, `(try* (glob "[") (catch* e (get e :type)))`, `:argument-error`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (mkdir "%s/c/d" :parents) (directory? "%s/c/d"))`, directory, directory), `true`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (delete-file "%s/c" :recursive) (file-exists? "%s/c"))`, directory, directory), `false`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(try* (delete-file "%s/a") (catch* e (get e :type)))`, directory), `:io-error`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (delete-file "%s/a" :recursive true) (list-dir "%s"))`, directory, directory), `("z")`, t)
+	}
+}
+
+func Test_Rename_And_Delete_File(t *testing.T) {
+	// the files are changed, so each evaluator gets its own
+	for name, eval := range evaluators {
+		directory := t.TempDir()
+		source, target := filepath.Join(directory, "source"), filepath.Join(directory, "target")
+
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (spit "%s" "x") (rename-file "%s" "%s") (list (file-exists? "%s") (slurp "%s")))`, source, source, target, source, target), `(false "x")`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(do (delete-file "%s") (file-exists? "%s"))`, target, target), `false`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(try* (delete-file "%s") (catch* e (get e :reason)))`, target), `:not-found`, t)
+	}
+}
+
+func Test_File_Info(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	Repl_Test(fmt.Sprintf(`(do (spit "%s" "12345") (get (file-info "%s") :size))`, path, path), `5`, t)
+	Repl_Test(fmt.Sprintf(`(get (file-info "%s") :directory?)`, path), `false`, t)
+	Repl_Test(fmt.Sprintf(`(get (file-info "%s") :name)`, path), `"file.txt"`, t)
+	Repl_Test(fmt.Sprintf(`(> (get (file-info "%s") :mtime) 0)`, path), `true`, t)
+}
+
+func Test_Temp_Files(t *testing.T) {
+	// the files are changed, so each evaluator gets its own
+	for name, eval := range evaluators {
+		directory := t.TempDir()
+
+		Evaluator_Test(name, eval, fmt.Sprintf(`(file-exists? (temp-file "x-*" :dir "%s"))`, directory), `true`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(directory? (temp-dir "y-*" :dir "%s"))`, directory), `true`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(count (list-dir "%s"))`, directory), `2`, t)
+	}
+}
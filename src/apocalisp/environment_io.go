@@ -0,0 +1,205 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"fmt"
+	"io"
+	"os"
+)
+
+// unclosable hides the Close method of the standard streams, so closing their
+// ports (e.g. through `with-open`) never closes the process' file descriptors.
+type unclosable struct {
+	io.ReadWriter
+}
+
+func portArgument(function string, args []core.Type, index int) (*core.Port, *core.Type) {
+	if index >= len(args) || !args[index].IsPort() {
+		exception := argumentException(function, fmt.Sprintf("argument %d must be a port.", index+1))
+		return nil, &exception
+	}
+	return args[index].AsPort(), nil
+}
+
+// streamPort returns the port a dynamic stream variable such as `*out*`
+// is currently bound to.
+func streamPort(environment *core.Environment, symbol string) (*core.Port, *core.Type) {
+	if node := environment.Get(symbol); node.IsPort() {
+		return node.AsPort(), nil
+	}
+	exception := *core.NewErrorException("io-error", fmt.Sprintf("`%s` is not bound to a port.", symbol))
+	return nil, &exception
+}
+
+func writeLine(environment *core.Environment, symbol string, s string) core.Type {
+	port, exception := streamPort(environment, symbol)
+	if exception != nil {
+		return *exception
+	}
+
+	if err := port.Write(s + "\n"); err != nil {
+		return ioException(err)
+	}
+	return *core.NewNil()
+}
+
+// inputArgument returns the port given as args[index], defaulting to `*in*`.
+func inputArgument(function string, environment *core.Environment, args []core.Type, index int) (*core.Port, *core.Type) {
+	if index >= len(args) {
+		return streamPort(environment, "*in*")
+	}
+	return portArgument(function, args, index)
+}
+
+func defineStreams(environment *core.Environment) {
+	stdout := core.NewOutputPort("stdout", unclosable{os.Stdout})
+	stdout.AsPort().AutoFlush = true
+	stderr := core.NewOutputPort("stderr", unclosable{os.Stderr})
+	stderr.AsPort().AutoFlush = true
+
+	environment.Set("*stdin*", *core.NewInputPort("stdin", unclosable{os.Stdin}))
+	environment.Set("*stdout*", *stdout)
+	environment.Set("*stderr*", *stderr)
+
+	// printing and reading builtins go through these dynamic variables, so
+	// rebinding them with `binding` redirects output and input
+	environment.DefineDynamic("*in*", environment.Get("*stdin*"))
+	environment.DefineDynamic("*out*", *stdout)
+	environment.DefineDynamic("*err*", *stderr)
+
+	environment.SetCallable("port?", func(args ...core.Type) core.Type {
+		if len(args) >= 1 {
+			return *core.NewBoolean(args[0].IsPort())
+		}
+		return *core.NewBoolean(false)
+	})
+
+	environment.SetCallableWithBindings("open-input", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("open-input", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if file, err := os.Open(resolvePath(caller, path)); err != nil {
+			return ioException(err)
+		} else {
+			return *core.NewInputPort(path, file)
+		}
+	})
+
+	environment.SetCallableWithBindings("open-output", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path, exception := stringArgument("open-output", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if optionEnabled(options(args[1:]), ":append") {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+
+		if file, err := os.OpenFile(resolvePath(caller, path), flags, 0666); err != nil {
+			return ioException(err)
+		} else {
+			return *core.NewOutputPort(path, file)
+		}
+	})
+
+	environment.SetCallableWithBindings("read-line", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		port, exception := inputArgument("read-line", caller, args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if line, err := port.ReadLine(); err == io.EOF {
+			return *core.NewNil()
+		} else if err != nil {
+			return ioException(err)
+		} else {
+			return *core.NewString(line)
+		}
+	})
+
+	environment.SetCallableWithBindings("read-char", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		port, exception := inputArgument("read-char", caller, args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if char, err := port.ReadChar(); err == io.EOF {
+			return *core.NewNil()
+		} else if err != nil {
+			return ioException(err)
+		} else {
+			return *core.NewString(char)
+		}
+	})
+
+	// `(reduce-lines f init port)` folds f over the lines read one at a time,
+	// e.g. to count the lines of a file bigger than memory
+	environment.SetCallableWithBindings("reduce-lines", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		if exception := functionArgument("reduce-lines", args, 0); exception != nil {
+			return *exception
+		} else if len(args) < 2 {
+			return argumentException("reduce-lines", "missing initial value.")
+		}
+		port, exception := inputArgument("reduce-lines", caller, args, 2)
+		if exception != nil {
+			return *exception
+		}
+
+		accumulator := args[1]
+		for {
+			if line, err := port.ReadLine(); err == io.EOF {
+				return accumulator
+			} else if err != nil {
+				return ioException(err)
+			} else if accumulator = call(bindings, args[0], accumulator, *core.NewString(line)); accumulator.IsException() {
+				return accumulator
+			}
+		}
+	})
+
+	environment.SetCallable("write", func(args ...core.Type) core.Type {
+		port, exception := portArgument("write", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		for _, arg := range args[1:] {
+			if err := port.Write(arg.ToString(false)); err != nil {
+				return ioException(err)
+			}
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallable("flush", func(args ...core.Type) core.Type {
+		port, exception := portArgument("flush", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if err := port.Flush(); err != nil {
+			return ioException(err)
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallable("close", func(args ...core.Type) core.Type {
+		port, exception := portArgument("close", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if err := port.Close(); err != nil {
+			return ioException(err)
+		}
+		return *core.NewNil()
+	})
+}
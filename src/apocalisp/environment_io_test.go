@@ -0,0 +1,62 @@
+package apocalisp
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Ports_Read_And_Write(t *testing.T) {
+	// the files are changed, so each evaluator gets its own
+	for name, eval := range evaluators {
+		path := filepath.Join(t.TempDir(), "file.txt")
+
+		Evaluator_Test(name, eval, fmt.Sprintf(`(let* [o (open-output "%s")] (do (write o "a" 1) (write o "\nb\n") (close o)))`, path), `nil`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(slurp "%s")`, path), `"a1\nb\n"`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(let* [i (open-input "%s")] (list (read-char i) (read-line i) (read-line i) (read-line i)))`, path), `("a" "1" "b" nil)`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(let* [i (open-input "%s")] (reduce-lines (fn* (acc line) (conj acc line)) [] i))`, path), `["a1" "b"]`, t)
+		Evaluator_Test(name, eval, `(with-in-str "a\nb\nc" (reduce-lines (fn* (n _) (+ n 1)) 0))`, `3`, t)
+		Evaluator_Test(name, eval, `(with-in-str "a\nb" (try* (reduce-lines (fn* (_ line) (throw line)) nil) (catch* e e)))`, `"a"`, t)
+		Evaluator_Test(name, eval, `(try* (reduce-lines 1 0) (catch* e (get e :type)))`, `:argument-error`, t)
+		Evaluator_Test(name, eval, fmt.Sprintf(`(let* [o (open-output "%s" :append true)] (do (write o "c") (close o) (slurp "%s")))`, path, path), `"a1\nb\nc"`, t)
+	}
+}
+
+func Test_Ports_Surface_Structured_Exceptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.txt")
+
+	Repl_Test(fmt.Sprintf(`(try* (open-input "%s") (catch* e (get e :reason)))`, path), `:not-found`, t)
+	Repl_Test(`(try* (read-line "not a port") (catch* e (get e :type)))`, `:argument-error`, t)
+	Repl_Test(`(try* (write *stdin* "x") (catch* e (get e :message)))`, `"port is not an output port"`, t)
+}
+
+func Test_With_Open_Closes_Ports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	Repl_Test(fmt.Sprintf(`(with-open [o (open-output "%s")] (write o "x") 1)`, path), `1`, t)
+	Repl_Test(fmt.Sprintf(`(with-open [i (open-input "%s")] (read-line i))`, path), `"x"`, t)
+	Repl_Test(fmt.Sprintf(`(let* [p (with-open [i (open-input "%s")] i)] (try* (read-line p) (catch* e (get e :message))))`, path), `"port is closed"`, t)
+	Repl_Test(fmt.Sprintf(`(let* [a (atom nil)] (do (try* (with-open [i (open-input "%s")] (reset! a i) (throw "boom")) (catch* e e)) (try* (read-line @a) (catch* e (get e :message)))))`, path), `"port is closed"`, t)
+	Repl_Test(`(port? *stdout*)`, `true`, t)
+}
+
+func Test_With_Out_Str_Captures_Printing(t *testing.T) {
+	Repl_Test(`(with-out-str (prn "a" 1) (println "b" 2))`, `"\"a\" 1\nb 2\n"`, t)
+	Repl_Test(`(with-out-str (with-out-str (println "inner")) (println "outer"))`, `"outer\n"`, t)
+	Repl_Test(`(with-out-str (write *out* "x") (flush *out*))`, `"x"`, t)
+	Repl_Test(`(with-out-str)`, `""`, t)
+}
+
+func Test_With_In_Str_Redirects_Reading(t *testing.T) {
+	Repl_Test(`(with-in-str "a\nb" (list (read-line) (read-line) (read-line)))`, `("a" "b" nil)`, t)
+	Repl_Test(`(with-in-str "xyz" (read-char))`, `"x"`, t)
+	Repl_Test(`(with-out-str (with-in-str "answer" (println (readline "> "))))`, `"> answer\n"`, t)
+}
+
+func Test_Binding_Restores_Previous_Values(t *testing.T) {
+	Repl_Test(`(let* [port *out*] (do (with-out-str (println 1)) (= port *out*)))`, `true`, t)
+	Repl_Test(`(let* [port *out*] (do (try* (binding [*out* *err*] (throw "boom")) (catch* e e)) (= port *out*)))`, `true`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (list (binding [*x* 2] *x*) *x*))`, `(2 1)`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (def! f (fn* () *x*)) (binding [*x* 2] (f)))`, `2`, t)
+	Repl_Test(`(with-out-str (binding [*err* *out*] (write *err* "redirected")))`, `"redirected"`, t)
+}
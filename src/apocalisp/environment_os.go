@@ -0,0 +1,215 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// resolvePath makes relative paths relative to the interpreter's current
+// directory, `*cwd*`, instead of the process' one.
+func resolvePath(environment *core.Environment, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	cwd := environment.Get("*cwd*")
+	return filepath.Join(cwd.AsString(), path)
+}
+
+func escapeGlob(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// globPaths expands pattern against `*cwd*`. Matches of a relative pattern are
+// relative too.
+func globPaths(environment *core.Environment, pattern string) ([]string, error) {
+	if filepath.IsAbs(pattern) {
+		return filepath.Glob(pattern)
+	}
+
+	cwd := environment.Get("*cwd*")
+	matches, err := filepath.Glob(filepath.Join(escapeGlob(cwd.AsString()), pattern))
+	for i := range matches {
+		if relative, rerr := filepath.Rel(cwd.AsString(), matches[i]); rerr == nil {
+			matches[i] = relative
+		}
+	}
+	return matches, err
+}
+
+// environmentVariables returns `*env*` in the `KEY=value` form processes
+// expect.
+func environmentVariables(environment *core.Environment) []string {
+	variables := make([]string, 0)
+	if env := environment.Get("*env*"); env.IsHashmap() {
+		for key, value := range env.AsHashmap() {
+			variables = append(variables, fmt.Sprintf("%s=%s", key.Identifier, value.ToString(false)))
+		}
+	}
+	return variables
+}
+
+func getenv(environment *core.Environment, name string) (string, bool) {
+	if env := environment.Get("*env*"); env.IsHashmap() {
+		if value, ok := env.AsHashmap()[core.NewHashmapKey(name, false)]; ok {
+			return value.ToString(false), true
+		}
+	}
+	return "", false
+}
+
+// lookPath finds program in the directories of the `PATH` held by `*env*`,
+// which may differ from the process' one.
+func lookPath(environment *core.Environment, program string) (string, bool) {
+	path, _ := getenv(environment, "PATH")
+	for _, directory := range filepath.SplitList(path) {
+		candidate := filepath.Join(resolvePath(environment, directory), program)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// newProcess creates a command running in `*cwd*` with `*env*` as its
+// environment.
+func newProcess(ctx context.Context, environment *core.Environment, argv []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	if !strings.ContainsRune(argv[0], filepath.Separator) {
+		if path, ok := lookPath(environment, argv[0]); ok {
+			cmd.Path, cmd.Err = path, nil
+		} else {
+			cmd.Err = &exec.Error{Name: argv[0], Err: exec.ErrNotFound}
+		}
+	}
+	cwd := environment.Get("*cwd*")
+	cmd.Dir = cwd.AsString()
+	cmd.Env = environmentVariables(environment)
+	return cmd
+}
+
+// changeDirectory resolves path against `*cwd*` and checks it's a directory.
+// An empty path stands for `HOME`.
+func changeDirectory(environment *core.Environment, path string) (string, *core.Type) {
+	if path == "" {
+		if home, ok := getenv(environment, "HOME"); ok {
+			path = home
+		}
+	}
+
+	target := resolvePath(environment, path)
+	if info, err := os.Stat(target); err != nil {
+		exception := ioException(err)
+		return "", &exception
+	} else if !info.IsDir() {
+		exception := *core.NewErrorException("io-error", fmt.Sprintf("%s: not a directory", path), *core.NewSymbol(":path"), *core.NewString(target))
+		return "", &exception
+	}
+	return target, nil
+}
+
+func defineOperatingSystem(environment *core.Environment) {
+	env := *core.NewHashmap()
+	for _, variable := range os.Environ() {
+		if name, value, ok := strings.Cut(variable, "="); ok {
+			env.HashmapSet(core.NewHashmapKey(name, false), *core.NewString(value))
+		}
+	}
+	environment.DefineDynamic("*env*", env)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = string(filepath.Separator)
+	}
+	environment.DefineDynamic("*cwd*", *core.NewString(cwd))
+
+	environment.SetCallableWithBindings("getenv", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		name, exception := stringArgument("getenv", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		if value, ok := getenv(caller, name); ok {
+			return *core.NewString(value)
+		}
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("setenv", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		name, exception := stringArgument("setenv", args, 0)
+		if exception != nil {
+			return *exception
+		} else if len(args) < 2 {
+			return argumentException("setenv", "missing value.")
+		}
+
+		current := caller.Get("*env*")
+		env := *core.NewHashmap()
+		for key, value := range current.AsHashmap() {
+			env.HashmapSet(key, value)
+		}
+		env.HashmapSet(core.NewHashmapKey(name, false), *core.NewString(args[1].ToString(false)))
+		caller.Var("*env*").Set(bindings, env)
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("unsetenv", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		name, exception := stringArgument("unsetenv", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		current := caller.Get("*env*")
+		env := *core.NewHashmap()
+		for key, value := range current.AsHashmap() {
+			if key != core.NewHashmapKey(name, false) {
+				env.HashmapSet(key, value)
+			}
+		}
+		caller.Var("*env*").Set(bindings, env)
+		return *core.NewNil()
+	})
+
+	environment.SetCallableWithBindings("env", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		return caller.Get("*env*")
+	})
+
+	environment.SetCallableWithBindings("cwd", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		return caller.Get("*cwd*")
+	})
+
+	environment.SetCallableWithBindings("cd", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		path := ""
+		if len(args) >= 1 {
+			var exception *core.Type
+			if path, exception = stringArgument("cd", args, 0); exception != nil {
+				return *exception
+			}
+		}
+
+		if target, exception := changeDirectory(caller, path); exception != nil {
+			return *exception
+		} else {
+			caller.Var("*cwd*").Set(bindings, *core.NewString(target))
+			return *core.NewString(target)
+		}
+	})
+}
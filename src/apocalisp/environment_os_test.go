@@ -0,0 +1,76 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Environment_Variables(t *testing.T) {
+	Repl_Test(`(getenv "APOCALISP_UNSET_VARIABLE")`, `nil`, t)
+	Repl_Test(`(do (setenv "APOCALISP_A" "1") (getenv "APOCALISP_A"))`, `"1"`, t)
+	Repl_Test(`(do (setenv "APOCALISP_A" 2) (get *env* "APOCALISP_A"))`, `"2"`, t)
+	Repl_Test(`(do (setenv "APOCALISP_A" "1") (unsetenv "APOCALISP_A") (getenv "APOCALISP_A"))`, `nil`, t)
+	Repl_Test(`(do (setenv "APOCALISP_A" "1") (= (env) *env*))`, `true`, t)
+	Repl_Test(`(try* (getenv 1) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Environment_Variables_Reach_Processes(t *testing.T) {
+	Repl_Test(`(do (setenv "APOCALISP_A" "abc") (get (sh "sh" "-c" "echo $APOCALISP_A") :out))`, `"abc\n"`, t)
+	Repl_Test(`(with-env {"APOCALISP_A" "def"} (get (sh "sh" "-c" "echo $APOCALISP_A") :out))`, `"def\n"`, t)
+	Repl_Test(`(do (with-env {:APOCALISP_A "def"} (setenv "APOCALISP_B" "1")) [(getenv "APOCALISP_A") (getenv "APOCALISP_B")])`, `[nil nil]`, t)
+	Repl_Test(`(with-env {"PATH" ""} (try* (sh "ls") (catch* e (get e :reason))))`, `:not-found`, t)
+}
+
+func Test_Working_Directory(t *testing.T) {
+	directory := t.TempDir()
+	nested := filepath.Join(directory, "nested")
+	os.Mkdir(nested, 0777)
+	os.WriteFile(filepath.Join(nested, "file.txt"), []byte("abc"), 0666)
+
+	Repl_Test(fmt.Sprintf(`(do (cd "%s") (cd "nested") (= (cwd) "%s"))`, directory, nested), `true`, t)
+	Repl_Test(fmt.Sprintf(`(do (cd "%s") (slurp "file.txt"))`, nested), `"abc"`, t)
+	Repl_Test(fmt.Sprintf(`(do (cd "%s") (glob "nested/*.txt"))`, directory), `("nested/file.txt")`, t)
+	Repl_Test(fmt.Sprintf(`(do (cd "%s") (get (sh "cat" "file.txt") :out))`, nested), `"abc"`, t)
+	Repl_Test(fmt.Sprintf(`(do (cd "%s") (get (sh "cat" "file.txt" :dir "nested") :out))`, directory), `"abc"`, t)
+	Repl_Test(fmt.Sprintf(`(try* (cd "%s/file.txt") (catch* e (get e :type)))`, nested), `:io-error`, t)
+	Repl_Test(fmt.Sprintf(`(try* (cd "%s/missing") (catch* e (get e :reason)))`, nested), `:not-found`, t)
+}
+
+func Test_With_Cwd(t *testing.T) {
+	directory := t.TempDir()
+	os.WriteFile(filepath.Join(directory, "file.txt"), []byte("abc"), 0666)
+
+	Repl_Test(fmt.Sprintf(`(with-cwd "%s" (slurp "file.txt"))`, directory), `"abc"`, t)
+	Repl_Test(fmt.Sprintf(`(let* [before (cwd)] (do (with-cwd "%s" (cd "..")) (= before (cwd))))`, directory), `true`, t)
+	Repl_Test(`(try* (with-cwd "/apocalisp/missing" nil) (catch* e (get e :reason)))`, `:not-found`, t)
+}
+
+func Test_Shell_Cd(t *testing.T) {
+	directory := t.TempDir()
+	os.Mkdir(filepath.Join(directory, "nested"), 0777)
+	out := filepath.Join(directory, "nested", "out.txt")
+
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	environment.Set("*shell-mode*", *core.NewBoolean(true))
+	report := core.NewStringOutputPort()
+	environment.Set("*err*", *report)
+	for _, line := range []string{fmt.Sprintf("cd %s/nested", directory), "echo abc > out.txt", "cd missing"} {
+		if err := RepShell(line, environment, Evaluate, parser.Parser{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if contents, err := os.ReadFile(out); err != nil || string(contents) != "abc\n" {
+		t.Errorf("`cd` should change the directory commands run in: %q %v", contents, err)
+	}
+	if status := environment.Get("*exit*"); status.ToString(true) != "1" {
+		t.Errorf("`cd` to a missing directory should fail, got %s", status.ToString(true))
+	} else if output := report.AsPort().Contents(); !strings.HasPrefix(output, "cd: ") {
+		t.Errorf("`cd` to a missing directory should report it, got `%s`", output)
+	}
+}
@@ -0,0 +1,273 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockedWriter serialises writes coming from several processes, e.g. the
+// stderr of every stage in a pipeline.
+type lockedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(p)
+}
+
+func processException(err error, program string) core.Type {
+	details := []core.Type{*core.NewSymbol(":command"), *core.NewString(program)}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		details = append(details, *core.NewSymbol(":reason"), *core.NewSymbol(":not-found"))
+	} else if errors.Is(err, fs.ErrPermission) {
+		details = append(details, *core.NewSymbol(":reason"), *core.NewSymbol(":permission"))
+	}
+	return *core.NewErrorException("process-error", err.Error(), details...)
+}
+
+// splitOptions separates positional arguments from the keyword/value options
+// following them, e.g. `"ls" "-la" :dir "/tmp"`.
+func splitOptions(args []core.Type) ([]core.Type, map[core.HashmapKey]core.Type) {
+	for i, arg := range args {
+		if arg.IsKeyword() {
+			return args[:i], options(args[i:])
+		}
+	}
+	return args, options([]core.Type{})
+}
+
+func optionValue(options map[core.HashmapKey]core.Type, keyword string) (core.Type, bool) {
+	value, ok := options[core.NewHashmapKey(keyword, true)]
+	return value, ok && !value.IsNil()
+}
+
+func newCommandSpec(function string, args []core.Type) core.Type {
+	positional, opts := splitOptions(args)
+	if len(positional) < 1 {
+		return argumentException(function, "missing program name.")
+	}
+
+	argv := *core.NewVector()
+	for i := range positional {
+		if _, exception := stringArgument(function, positional, i); exception != nil {
+			return *exception
+		}
+		argv.Append(positional[i])
+	}
+
+	spec := *core.NewHashmap()
+	for key, value := range opts {
+		spec.HashmapSet(key, value)
+	}
+	spec.HashmapSet(core.NewHashmapKey(":argv", true), argv)
+	return spec
+}
+
+func command(ctx context.Context, environment *core.Environment, spec core.Type) (*exec.Cmd, *core.Type) {
+	if !spec.IsHashmap() {
+		exception := argumentException("pipe", "commands must be created with `cmd`.")
+		return nil, &exception
+	}
+
+	opts := spec.AsHashmap()
+	argvNode, _ := optionValue(opts, ":argv")
+	argv := make([]string, 0)
+	for _, arg := range argvNode.AsIterable() {
+		argv = append(argv, arg.AsString())
+	}
+	if len(argv) < 1 {
+		exception := argumentException("pipe", "commands must be created with `cmd`.")
+		return nil, &exception
+	}
+
+	cmd := newProcess(ctx, environment, argv)
+	if dir, ok := optionValue(opts, ":dir"); ok {
+		cmd.Dir = resolvePath(environment, dir.AsString())
+	}
+	// `:env` extends the interpreter's environment instead of replacing it
+	if env, ok := optionValue(opts, ":env"); ok && env.IsHashmap() {
+		for key, value := range env.AsHashmap() {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", strings.TrimPrefix(key.Identifier, ":"), value.ToString(false)))
+		}
+	}
+	return cmd, nil
+}
+
+// processInput resolves the `:in` option: a string is fed to the process, a
+// port is streamed into it.
+func processInput(environment *core.Environment, opts map[core.HashmapKey]core.Type) (io.Reader, *core.Type) {
+	in, ok := optionValue(opts, ":in")
+	if !ok {
+		return nil, nil
+	} else if in.IsString() {
+		return strings.NewReader(in.AsString()), nil
+	} else if stdin := environment.Get("*stdin*"); in.Compare(stdin) {
+		return os.Stdin, nil
+	} else if in.IsPort() && in.AsPort().IsInput() {
+		return in.AsPort().Reader(), nil
+	}
+	exception := argumentException("sh", "`:in` must be a string or an input port.")
+	return nil, &exception
+}
+
+// processOutput resolves the `:out` and `:err` options: a port receives the
+// stream as it is produced, otherwise it's captured in buffer.
+func processOutput(environment *core.Environment, opts map[core.HashmapKey]core.Type, keyword string, standard string, buffer *bytes.Buffer) (io.Writer, *core.Type) {
+	out, ok := optionValue(opts, keyword)
+	if !ok {
+		return buffer, nil
+	} else if stream := environment.Get(standard); out.Compare(stream) {
+		// hand the process the real descriptor, so it can tell it's a terminal
+		if standard == "*stdout*" {
+			return os.Stdout, nil
+		}
+		return os.Stderr, nil
+	} else if out.IsPort() && out.AsPort().IsOutput() {
+		return out.AsPort().Writer(), nil
+	}
+	exception := argumentException("sh", fmt.Sprintf("`%s` must be an output port.", keyword))
+	return nil, &exception
+}
+
+// runPipeline runs specs with the stdout of each connected to the stdin of
+// the next one, and reports the exit status and output of the last one.
+func runPipeline(environment *core.Environment, specs []core.Type, opts map[core.HashmapKey]core.Type) core.Type {
+	if len(specs) < 1 {
+		return argumentException("pipe", "missing commands.")
+	}
+
+	ctx, cancel := context.Background(), func() {}
+	if timeout, ok := optionValue(opts, ":timeout"); ok && timeout.IsNumber() {
+		ms, _ := timeout.AsNumber().Int64()
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+	}
+	defer cancel()
+
+	commands := make([]*exec.Cmd, 0)
+	for _, spec := range specs {
+		if cmd, exception := command(ctx, environment, spec); exception != nil {
+			return *exception
+		} else {
+			commands = append(commands, cmd)
+		}
+	}
+
+	var stdoutBuffer, stderrBuffer bytes.Buffer
+	stdin, exception := processInput(environment, opts)
+	if exception != nil {
+		return *exception
+	}
+	stdout, exception := processOutput(environment, opts, ":out", "*stdout*", &stdoutBuffer)
+	if exception != nil {
+		return *exception
+	}
+	stderr, exception := processOutput(environment, opts, ":err", "*stderr*", &stderrBuffer)
+	if exception != nil {
+		return *exception
+	}
+	stderr = &lockedWriter{writer: stderr}
+
+	first, last := commands[0], commands[len(commands)-1]
+	first.Stdin, last.Stdout = stdin, stdout
+
+	pipes := make([]*os.File, 0)
+	defer func() {
+		for _, pipe := range pipes {
+			pipe.Close()
+		}
+	}()
+	for i := 0; i+1 < len(commands); i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return ioException(err)
+		}
+		pipes = append(pipes, r, w)
+		commands[i].Stdout, commands[i+1].Stdin = w, r
+	}
+
+	for i, cmd := range commands {
+		cmd.Stderr = stderr
+		if err := cmd.Start(); err != nil {
+			for _, started := range commands[:i] {
+				started.Process.Kill()
+				started.Wait()
+			}
+			return processException(err, cmd.Path)
+		}
+	}
+
+	// the children hold their own copies of the pipe descriptors
+	for _, pipe := range pipes {
+		pipe.Close()
+	}
+	pipes = nil
+
+	exits := *core.NewVector()
+	var waitError error
+	for _, cmd := range commands {
+		var exitError *exec.ExitError
+		if err := cmd.Wait(); err != nil && !errors.As(err, &exitError) && waitError == nil {
+			waitError = err
+		}
+		exits.Append(*core.NewNumber(float64(cmd.ProcessState.ExitCode())))
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return *core.NewErrorException("timeout", "process timed out", *core.NewSymbol(":command"), *core.NewString(last.Path))
+	} else if waitError != nil {
+		return processException(waitError, last.Path)
+	}
+
+	result := []core.Type{*core.NewSymbol(":exit"), exits.AsIterable()[len(commands)-1]}
+	if stdout == &stdoutBuffer {
+		result = append(result, *core.NewSymbol(":out"), *core.NewString(stdoutBuffer.String()))
+	} else {
+		result = append(result, *core.NewSymbol(":out"), *core.NewNil())
+	}
+	if _, captured := optionValue(opts, ":err"); !captured {
+		result = append(result, *core.NewSymbol(":err"), *core.NewString(stderrBuffer.String()))
+	} else {
+		result = append(result, *core.NewSymbol(":err"), *core.NewNil())
+	}
+	if len(commands) > 1 {
+		result = append(result, *core.NewSymbol(":exits"), exits)
+	}
+	return *core.NewHashmapFromSequence(result)
+}
+
+func defineProcesses(environment *core.Environment) {
+	environment.SetCallable("cmd", func(args ...core.Type) core.Type {
+		return newCommandSpec("cmd", args)
+	})
+
+	environment.SetCallableWithBindings("sh", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		// `:dir` and `:env` describe the command, while `:in`, `:out`, `:err`
+		// and `:timeout` apply to running it
+		if spec := newCommandSpec("sh", args); spec.IsException() {
+			return spec
+		} else {
+			_, opts := splitOptions(args)
+			return runPipeline(caller, []core.Type{spec}, opts)
+		}
+	})
+
+	environment.SetCallableWithBindings("pipe", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		specs, opts := splitOptions(args)
+		return runPipeline(caller, specs, opts)
+	})
+}
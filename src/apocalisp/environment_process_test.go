@@ -0,0 +1,39 @@
+package apocalisp
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Sh_Captures_Exit_Status_And_Output(t *testing.T) {
+	Repl_Test(`(get (sh "echo" "-n" "hello") :out)`, `"hello"`, t)
+	Repl_Test(`(get (sh "sh" "-c" "echo oops >&2; exit 3") :exit)`, `3`, t)
+	Repl_Test(`(get (sh "sh" "-c" "echo oops >&2; exit 3") :err)`, `"oops\n"`, t)
+	Repl_Test(`(get (sh "cat" :in "from stdin") :out)`, `"from stdin"`, t)
+}
+
+func Test_Sh_Options(t *testing.T) {
+	directory := t.TempDir()
+
+	Repl_Test(fmt.Sprintf(`(= (get (sh "pwd" :dir "%s") :out) "%s\n")`, directory, directory), `true`, t)
+	Repl_Test(`(get (sh "sh" "-c" "echo -n $GREETING" :env {"GREETING" "hi"}) :out)`, `"hi"`, t)
+	Repl_Test(`(try* (sh "sleep" "5" :timeout 50) (catch* e (get e :type)))`, `:timeout`, t)
+	Repl_Test(`(try* (sh "apocalisp-no-such-program") (catch* e (list (get e :type) (get e :reason))))`, `(:process-error :not-found)`, t)
+	Repl_Test(`(try* (sh) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Sh_Streams_To_Ports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	Repl_Test(`(with-out-str (sh "echo" "streamed" :out *out*))`, `"streamed\n"`, t)
+	Repl_Test(`(with-out-str (prn (get (sh "echo" "streamed" :out *out*) :out)))`, `"streamed\nnil\n"`, t)
+	Repl_Test(fmt.Sprintf(`(do (spit "%s" "a\nb\n") (with-open [i (open-input "%s")] (get (sh "wc" "-l" :in i) :out)))`, path, path), `"2\n"`, t)
+}
+
+func Test_Pipe_Connects_Commands(t *testing.T) {
+	Repl_Test(`(get (pipe (cmd "printf" "a\nb\nab\n") (cmd "grep" "a") (cmd "wc" "-l")) :out)`, `"2\n"`, t)
+	Repl_Test(`(get (pipe (cmd "sh" "-c" "exit 2") (cmd "true")) :exits)`, `[2 0]`, t)
+	Repl_Test(`(get (pipe (cmd "cat") (cmd "tr" "a-z" "A-Z") :in "shout") :out)`, `"SHOUT"`, t)
+	Repl_Test(`(try* (pipe "echo") (catch* e (get e :type)))`, `:argument-error`, t)
+}
@@ -0,0 +1,54 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// interrupted is set by Interrupt, and cleared before the REPL evaluates the
+// next input.
+var interrupted int32
+
+// interruption is closed by Interrupt, for builtins waiting on futures and
+// channels, and replaced once the interrupt is cleared.
+var interruption = make(chan struct{})
+var interruptionMutex sync.Mutex
+
+// Interrupt makes the running evaluations stop, e.g. on Ctrl-C. It stays set,
+// so handlers catching the exception can't go on either.
+func Interrupt() {
+	interruptionMutex.Lock()
+	defer interruptionMutex.Unlock()
+	if atomic.SwapInt32(&interrupted, 1) == 0 {
+		close(interruption)
+	}
+}
+
+func clearInterrupt() {
+	interruptionMutex.Lock()
+	defer interruptionMutex.Unlock()
+	if atomic.SwapInt32(&interrupted, 0) == 1 {
+		interruption = make(chan struct{})
+	}
+}
+
+// interruptions returns the channel closed by the next Interrupt.
+func interruptions() <-chan struct{} {
+	interruptionMutex.Lock()
+	defer interruptionMutex.Unlock()
+	return interruption
+}
+
+func isInterrupted() bool {
+	return atomic.LoadInt32(&interrupted) != 0
+}
+
+func interruptedException() *core.Type {
+	return core.NewErrorException("interrupted", "Evaluation interrupted.")
+}
+
+func cancelledException(name string) *core.Type {
+	return core.NewErrorException("cancelled", fmt.Sprintf("The %s was cancelled.", name))
+}
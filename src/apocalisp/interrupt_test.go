@@ -0,0 +1,70 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"testing"
+	"time"
+)
+
+func Test_Interrupt_Stops_Evaluation(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	defer clearInterrupt()
+
+	for _, in := range []string{loop, `(try* ` + loop + ` (catch* e (count (list ` + loop + `))))`} {
+		clearInterrupt()
+		node, _ := parser.Parser{}.Parse(in)
+		results := make(chan *core.Type)
+		go func() {
+			result, _ := Evaluate(node, environment)
+			results <- result
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		Interrupt()
+		select {
+		case result := <-results:
+			if result == nil || !result.IsException() {
+				t.Errorf("%s: expected an exception, got %v.", in, result)
+			} else if kind := result.AsException().AsHashmap()[core.NewHashmapKey(":type", true)]; kind.ToString(true) != ":interrupted" {
+				t.Errorf("%s: unexpected exception %s.", in, result.ToString(true))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the evaluation wasn't interrupted.", in)
+		}
+	}
+
+	// the environment is kept
+	clearInterrupt()
+	if out, err := Rep(`(fn? loop)`, environment, Evaluate, parser.Parser{}); err != nil || out != "true" {
+		t.Errorf("(output) `%s`, %v != `true` (expected)", out, err)
+	}
+}
+
+func Test_Interrupt_Stops_Waiting(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	defer clearInterrupt()
+
+	for _, in := range []string{`@(promise)`, `(take! (chan))`, `(put! (chan) 1)`, `(alts! [(chan)])`} {
+		clearInterrupt()
+		node, _ := parser.Parser{}.Parse(in)
+		results := make(chan *core.Type)
+		go func() {
+			result, _ := Evaluate(node, environment)
+			results <- result
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		Interrupt()
+		select {
+		case result := <-results:
+			if result == nil || !result.IsException() {
+				t.Errorf("%s: expected an exception, got %v.", in, result)
+			} else if kind := result.AsException().AsHashmap()[core.NewHashmapKey(":type", true)]; kind.ToString(true) != ":interrupted" {
+				t.Errorf("%s: unexpected exception %s.", in, result.ToString(true))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the wait wasn't interrupted.", in)
+		}
+	}
+}
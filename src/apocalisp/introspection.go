@@ -0,0 +1,211 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// definitionMetadata is the metadata of the var a `def!` or `defmacro!`
+// defines, including where it was defined.
+func definitionMetadata(rest []core.Type, value core.Type, source *core.Source, environment *core.Environment) core.Type {
+	metadata := *core.NewHashmap()
+	set := func(key string, value core.Type) {
+		metadata.HashmapSet(core.NewHashmapKey(key, true), value)
+	}
+
+	set(":name", rest[0])
+	if len(rest) == 3 {
+		set(":doc", rest[1])
+	}
+	if value.IsFunction() {
+		params := core.NewVector()
+		for _, param := range value.Function.Params {
+			params.Append(*core.NewSymbol(param))
+		}
+		set(":arglists", *core.NewList(*params))
+		if value.Function.IsMacro {
+			set(":macro", *core.NewBoolean(true))
+		}
+	}
+	if source != nil {
+		set(":source", *core.NewString(source.Text))
+		set(":line", *core.NewNumber(float64(source.Line)))
+		set(":column", *core.NewNumber(float64(source.Column)))
+	}
+	if file := environment.Get("*file*"); file.IsString() {
+		set(":file", file)
+	}
+	return metadata
+}
+
+func metadataValue(metadata core.Type, key string) (core.Type, bool) {
+	if !metadata.IsHashmap() {
+		return *core.NewNil(), false
+	}
+	value, ok := metadata.AsHashmap()[core.NewHashmapKey(key, true)]
+	return value, ok
+}
+
+// varArgument returns the name and metadata of the var given as args[index],
+// as returned by `var`.
+func varArgument(function string, args []core.Type, index int) (string, core.Type, *core.Type) {
+	if index < len(args) && args[index].IsException() {
+		return "", core.Type{}, &args[index]
+	} else if index >= len(args) || !args[index].IsSymbol() || args[index].IsKeyword() {
+		exception := argumentException(function, fmt.Sprintf("argument %d must be a var.", index+1))
+		return "", core.Type{}, &exception
+	}
+
+	metadata := *core.NewNil()
+	if args[index].Metadata != nil {
+		metadata = *args[index].Metadata
+	}
+	return args[index].AsSymbol(), metadata, nil
+}
+
+// specialFormVar returns the symbol naming a binding, carrying the binding's
+// metadata, so `(meta (var name))` describes it.
+func specialFormVar(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) != 1 || !rest[0].IsSymbol() {
+		return nil, errors.New("Error: Invalid syntax for `var`.")
+	}
+
+	symbol := rest[0].AsSymbol()
+	if environment.Find(symbol) == nil {
+		return core.NewStringException(fmt.Sprintf("'%s' not found", symbol)), nil
+	}
+	metadata := environment.GetMetadata(symbol)
+	return &core.Type{Symbol: &symbol, Metadata: &metadata}, nil
+}
+
+// macrostep expands the leftmost outermost macro call in node, skipping quoted
+// forms like `macroexpand-all`, and tells whether there was one.
+func macrostep(node core.Type, environment *core.Environment) (core.Type, bool) {
+	if expanded, ok := macroexpand1(node, environment); ok {
+		return expanded, true
+	}
+
+	iterable := node.AsIterable()
+	if node.IsList() && len(iterable) >= 1 {
+		if iterable[0].CompareSymbol("quote") {
+			return node, false
+		} else if iterable[0].CompareSymbol("quasiquote", "syntax-quote") {
+			return steppedForms(node, func(form core.Type) (core.Type, bool) {
+				return macrostepTemplate(form, environment)
+			}, 1)
+		}
+	}
+	return steppedForms(node, func(form core.Type) (core.Type, bool) {
+		return macrostep(form, environment)
+	}, 0)
+}
+
+func macrostepTemplate(node core.Type, environment *core.Environment) (core.Type, bool) {
+	if iterable := node.AsIterable(); node.IsList() && len(iterable) == 2 && iterable[0].CompareSymbol("unquote", "splice-unquote") {
+		expanded, ok := macrostep(iterable[1], environment)
+		return *core.NewList(iterable[0], expanded), ok
+	}
+	return steppedForms(node, func(form core.Type) (core.Type, bool) {
+		return macrostepTemplate(form, environment)
+	}, 0)
+}
+
+// steppedForms is expandedForms stepping only the first form that expands.
+func steppedForms(node core.Type, step func(core.Type) (core.Type, bool), start int) (core.Type, bool) {
+	stepped := false
+	expanded := expandedForms(node, func(form core.Type) core.Type {
+		if stepped {
+			return form
+		}
+		form, stepped = step(form)
+		return form
+	}, start)
+	return expanded, stepped
+}
+
+// specialFormMacrostep prints a form, then each step of its expansion.
+func specialFormMacrostep(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) != 1 {
+		return nil, errors.New("Error: Invalid syntax for `macrostep`.")
+	}
+
+	lines := []string{rest[0].ToString(true)}
+	for node, ok := macrostep(rest[0], environment); ok; node, ok = macrostep(node, environment) {
+		if node.IsException() {
+			return &node, nil
+		}
+		lines = append(lines, "=> "+node.ToString(true))
+	}
+	result := writeLine(environment, "*out*", strings.Join(lines, "\n"))
+	return &result, nil
+}
+
+func defineIntrospection(environment *core.Environment) {
+	// bound by `load-file` to the file being loaded
+	environment.DefineDynamic("*file*", *core.NewNil())
+
+	// `doc` and `source` are macros calling these with `(var name)`
+	environment.SetCallableWithBindings("print-doc", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		symbol, metadata, exception := varArgument("print-doc", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		text := "No documentation found."
+		if doc, ok := metadataValue(metadata, ":doc"); ok {
+			text = doc.ToString(false)
+		}
+
+		lines := []string{"-------------------------", symbol}
+		if arglists, ok := metadataValue(metadata, ":arglists"); ok {
+			lines = append(lines, arglists.ToString(true))
+		}
+		if macro, ok := metadataValue(metadata, ":macro"); ok && macro.CompareBoolean(true) {
+			lines = append(lines, "Macro")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, "  "+line)
+		}
+		return writeLine(environment.WithBindings(bindings), "*out*", strings.Join(lines, "\n"))
+	})
+
+	environment.SetCallableWithBindings("print-source", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		_, metadata, exception := varArgument("print-source", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		text := "Source not found."
+		if source, ok := metadataValue(metadata, ":source"); ok {
+			text = source.ToString(false)
+		}
+		return writeLine(environment.WithBindings(bindings), "*out*", text)
+	})
+
+	// dir lists the global bindings: a builtin can't see the locals of its
+	// caller
+	environment.SetCallable("dir", func(args ...core.Type) core.Type {
+		symbols := *core.NewList()
+		for _, symbol := range environment.Symbols() {
+			symbols.Append(*core.NewSymbol(symbol))
+		}
+		return symbols
+	})
+
+	environment.SetCallable("apropos", func(args ...core.Type) core.Type {
+		pattern, exception := stringArgument("apropos", args, 0)
+		if exception != nil {
+			return *exception
+		}
+
+		matches := *core.NewList()
+		for _, symbol := range withPrefix("", append(environment.Symbols(), specialForms...)) {
+			if strings.Contains(symbol, pattern) {
+				matches.Append(*core.NewSymbol(symbol))
+			}
+		}
+		return matches
+	})
+}
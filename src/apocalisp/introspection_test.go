@@ -0,0 +1,107 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Syntax_Error_Test(in string, eerr string, t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	if _, err := Rep(in, environment, Evaluate, parser.Parser{}); err == nil || err.Error() != eerr {
+		t.Errorf("(error) `%v` != `%s` (expected)", err, eerr)
+	}
+}
+
+func Test_Def_With_Docstring(t *testing.T) {
+	Repl_Test(`(def! x "The answer." 42)`, `42`, t)
+	Repl_Test(`(def! x "not a docstring")`, `"not a docstring"`, t)
+	Syntax_Error_Test(`(def! x "a" "b" 1)`, "Error: Invalid syntax for `def!`.", t)
+}
+
+func Test_Doc(t *testing.T) {
+	Repl_Test(`(do (def! x "The answer.\nTo everything." 42) (with-out-str (doc x)))`, `"-------------------------\nx\n  The answer.\n  To everything.\n"`, t)
+	Repl_Test(`(do (def! x 42) (with-out-str (doc x)))`, `"-------------------------\nx\n  No documentation found.\n"`, t)
+	Repl_Test(`(try* (doc apocalisp-undefined) (catch* e e))`, `"'apocalisp-undefined' not found"`, t)
+	Syntax_Error_Test(`(doc "x")`, "Error: Invalid syntax for `var`.", t)
+	Repl_Test(`(try* (print-doc 1) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Source(t *testing.T) {
+	Repl_Test(`(do (def! f (fn* (x)   (* x 2))) (with-out-str (source f)))`, `"(def! f (fn* (x)   (* x 2)))\n"`, t)
+	Repl_Test(`(with-out-str (source +))`, `"Source not found.\n"`, t)
+}
+
+func Test_Introspection_Names_Can_Be_Bound(t *testing.T) {
+	Repl_Test(`(let* [doc (fn* (x) (str "doc of " x)) source 1 dir [2]] [(doc "f") source dir])`, `["doc of f" 1 [2]]`, t)
+	Repl_Test(`((fn* (doc) (doc 3)) (fn* (x) (* x 2)))`, `6`, t)
+	Repl_Test(`(do (def! doc (fn* (x) x)) (doc 4))`, `4`, t)
+}
+
+func Test_Apropos_And_Dir(t *testing.T) {
+	Repl_Test(`(apropos "-file")`, `(delete-file load-file rename-file temp-file)`, t)
+	Repl_Test(`(apropos "ith-o")`, `(with-open with-out-str)`, t)
+
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	if output, _ := Rep(`(do (def! apocalisp-global 1) (dir))`, environment, Evaluate, parser.Parser{}); !strings.Contains(output, " apocalisp-global ") {
+		t.Errorf("`dir` should list global bindings, got `%s`.", output)
+	}
+}
+
+func Test_Remember_Results(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	for _, symbol := range []string{"*1", "*2", "*3"} {
+		environment.Set(symbol, *core.NewNil())
+	}
+
+	for _, value := range []float64{1, 2, 3, 4} {
+		rememberValue(environment, *core.NewNumber(value))
+	}
+	if output, _ := Rep(`[*1 *2 *3]`, environment, Evaluate, parser.Parser{}); output != `[4 3 2]` {
+		t.Errorf("(output) `%s` != `[4 3 2]` (expected)", output)
+	}
+
+	value, _ := readEval(`(throw {:type :oops})`, environment, Evaluate, parser.Parser{})
+	rememberException(environment, *value.AsException())
+	if output, _ := Rep(`(get *e :type)`, environment, Evaluate, parser.Parser{}); output != `:oops` {
+		t.Errorf("(output) `%s` != `:oops` (expected)", output)
+	}
+}
+
+func Test_Definition_Metadata(t *testing.T) {
+	Repl_Test(`(do (def! f "Doubles." (fn* (x) (* x 2))) (get (meta (var f)) :arglists))`, `([x])`, t)
+	Repl_Test(`(do (def! f "Doubles." (fn* (x) (* x 2))) (get (meta (var f)) :doc))`, `"Doubles."`, t)
+	Repl_Test(`(do (def! f 1) [(get (meta (var f)) :name) (get (meta (var f)) :line) (get (meta (var f)) :column)])`, `[f 1 5]`, t)
+	Repl_Test(`(do (defmacro! m "Ignores." (fn* (& xs) nil)) [(get (meta (var m)) :macro) (get (meta (var m)) :doc)])`, `[true "Ignores."]`, t)
+	Repl_Test(`(do (defmacro! m "Ignores." (fn* (& xs) nil)) (with-out-str (doc m)))`, `"-------------------------\nm\n([& xs])\nMacro\n  Ignores.\n"`, t)
+	Repl_Test(`(do (def! f (fn* (x) x)) (meta f))`, `nil`, t)
+	Repl_Test(`(meta (var +))`, `nil`, t)
+}
+
+func Test_Definition_Metadata_Records_The_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.mal")
+	os.WriteFile(path, []byte("\n\n  (def! apocalisp-f (fn* (x) x))\n"), 0666)
+
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	Rep(fmt.Sprintf(`(load-file "%s")`, path), environment, Evaluate, parser.Parser{})
+
+	output, _ := Rep(`(let* [m (meta (var apocalisp-f))] [(= (get m :file) *file*) (get m :line) (get m :column)])`, environment, Evaluate, parser.Parser{})
+	if output != "[false 3 3]" {
+		t.Errorf("(output) `%s` != `[false 3 3]` (expected)", output)
+	}
+	if output, _ := Rep(fmt.Sprintf(`(= (get (meta (var apocalisp-f)) :file) "%s")`, path), environment, Evaluate, parser.Parser{}); output != "true" {
+		t.Errorf("`:file` should be the loaded file, got `%s`.", output)
+	}
+}
+
+func Test_Macrostep(t *testing.T) {
+	Repl_Test(`(with-out-str (macrostep (when-not a (-> x f))))`, `"(when-not a (-> x f))\n=> (if a nil (do (-> x f)))\n=> (if a nil (do (user/-> (f x))))\n=> (if a nil (do (f x)))\n"`, t)
+	Repl_Test(`(with-out-str (macrostep (quote (when a 1))))`, `"(quote (when a 1))\n"`, t)
+	Syntax_Error_Test(`(macrostep)`, "Error: Invalid syntax for `macrostep`.", t)
+	Syntax_Error_Test(`(macroexpand-all a b)`, "Error: Invalid syntax for `macroexpand-all`.", t)
+}
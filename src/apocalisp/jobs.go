@@ -0,0 +1,339 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	processRunning = iota
+	processStopped
+	processDone
+)
+
+type process struct {
+	cmd    *exec.Cmd
+	state  int
+	status int
+}
+
+// job is a pipeline started from shell mode. All of its processes share the
+// process group pgid, so they can be stopped, resumed and killed together.
+type job struct {
+	id        int
+	pgid      int
+	text      string
+	processes []*process
+	// chain is set instead of the processes for an and/or list run in the
+	// background
+	chain *jobChain
+}
+
+// jobChain is an and/or list run in the background as a single job, like a
+// subshell: a goroutine starts its pipelines one after the other.
+type jobChain struct {
+	mutex sync.Mutex
+	// pgid is the process group of the pipeline running
+	pgid     int
+	status   int
+	finished chan struct{}
+}
+
+func (j *job) state() int {
+	if j.chain != nil {
+		select {
+		case <-j.chain.finished:
+			return processDone
+		default:
+			return processRunning
+		}
+	}
+
+	state := processDone
+	for _, p := range j.processes {
+		if p.state == processStopped {
+			return processStopped
+		} else if p.state == processRunning {
+			state = processRunning
+		}
+	}
+	return state
+}
+
+// status is the exit status of the last process of the pipeline, or of the
+// last pipeline of a chain.
+func (j *job) status() int {
+	if j.chain != nil {
+		return j.chain.status
+	}
+	return j.processes[len(j.processes)-1].status
+}
+
+// group is the process group of the job, or 0 while a chain runs no pipeline.
+func (j *job) group() int {
+	if j.chain != nil {
+		j.chain.mutex.Lock()
+		defer j.chain.mutex.Unlock()
+		return j.chain.pgid
+	}
+	return j.pgid
+}
+
+func (j *job) describe() string {
+	switch j.state() {
+	case processRunning:
+		return "Running"
+	case processStopped:
+		return "Stopped"
+	default:
+		if status := j.status(); status == 0 {
+			return "Done"
+		} else {
+			return fmt.Sprintf("Exit %d", status)
+		}
+	}
+}
+
+// update collects state changes of the job's processes, blocking for one if
+// block is set. The goroutine running a chain collects those of its own.
+func (j *job) update(block bool) {
+	if j.chain != nil {
+		if block {
+			<-j.chain.finished
+		}
+		return
+	}
+
+	for _, p := range j.processes {
+		if p.state != processDone {
+			waitProcess(p, block)
+		}
+	}
+}
+
+func (j *job) resume() {
+	for _, p := range j.processes {
+		if p.state == processStopped {
+			p.state = processRunning
+		}
+	}
+	j.signal("CONT")
+}
+
+// signal signals the process group of the job. A chain running no pipeline
+// has none, and signalling group 0 would signal the shell.
+func (j *job) signal(name string) error {
+	pgid := j.group()
+	if pgid == 0 {
+		return errors.New(fmt.Sprintf("%%%d: no process running", j.id))
+	}
+	return signalGroup(pgid, name)
+}
+
+func (j *job) wait() int {
+	for j.state() != processDone {
+		j.update(true)
+	}
+	return j.status()
+}
+
+type jobTable struct {
+	mutex sync.Mutex
+	jobs  map[int]*job
+}
+
+var jobs = jobTable{jobs: make(map[int]*job)}
+
+func (table *jobTable) add(j *job) *job {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	j.id = 1
+	for table.jobs[j.id] != nil {
+		j.id++
+	}
+	table.jobs[j.id] = j
+	return j
+}
+
+func (table *jobTable) remove(j *job) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	delete(table.jobs, j.id)
+}
+
+func (table *jobTable) sorted() []*job {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	sorted := make([]*job, 0)
+	for _, j := range table.jobs {
+		sorted = append(sorted, j)
+	}
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].id < sorted[b].id })
+	return sorted
+}
+
+// find resolves a job specification: `%n`, a bare job number, or nothing for
+// the most recent job.
+func (table *jobTable) find(spec string) (*job, error) {
+	sorted := table.sorted()
+	if spec == "" {
+		if len(sorted) == 0 {
+			return nil, errors.New("no current job")
+		}
+		return sorted[len(sorted)-1], nil
+	}
+
+	if id, err := strconv.Atoi(strings.TrimPrefix(spec, "%")); err == nil {
+		for _, j := range sorted {
+			if j.id == id {
+				return j, nil
+			}
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("%s: no such job", spec))
+}
+
+// notify reports background jobs that finished since the last prompt and
+// forgets about them.
+func (table *jobTable) notify(w io.Writer) {
+	for _, j := range table.sorted() {
+		if j.update(false); j.state() == processDone {
+			fmt.Fprintf(w, "[%d] %s\t%s\n", j.id, j.describe(), j.text)
+			table.remove(j)
+		}
+	}
+}
+
+// startJob starts commands in a new process group, handed the terminal if
+// it's in the foreground. The job isn't added to the table.
+func startJob(commands []*exec.Cmd, text string, foreground bool) (*job, error) {
+	pgid := 0
+	for i, cmd := range commands {
+		setProcessGroup(cmd, pgid, foreground && i == 0)
+		if err := cmd.Start(); err != nil {
+			if pgid != 0 {
+				signalGroup(pgid, "KILL")
+				for _, started := range commands[:i] {
+					waitProcess(&process{cmd: started}, true)
+				}
+				takeTerminal()
+			}
+			return nil, err
+		}
+		if i == 0 {
+			pgid = cmd.Process.Pid
+		}
+	}
+	j := &job{pgid: pgid, text: text}
+	for _, cmd := range commands {
+		j.processes = append(j.processes, &process{cmd: cmd})
+	}
+	return j, nil
+}
+
+// waitForeground waits until j finishes or is stopped, e.g. by Ctrl-Z, then
+// takes the terminal back and returns the job's exit status.
+func waitForeground(j *job, report io.Writer) int {
+	for j.state() == processRunning {
+		j.update(true)
+	}
+	takeTerminal()
+
+	if j.state() == processStopped {
+		fmt.Fprintf(report, "\n[%d] %s\t%s\n", j.id, j.describe(), j.text)
+		return 128 + stopSignal
+	}
+
+	jobs.remove(j)
+	return j.wait()
+}
+
+var shellBuiltins = map[string]func(args []string, environment *core.Environment, out io.Writer, report io.Writer) int{
+	"jobs": func(args []string, environment *core.Environment, out io.Writer, report io.Writer) int {
+		for _, j := range jobs.sorted() {
+			j.update(false)
+			group := "-"
+			if pgid := j.group(); pgid != 0 {
+				group = strconv.Itoa(pgid)
+			}
+			fmt.Fprintf(out, "[%d] %s %s\t%s\n", j.id, group, j.describe(), j.text)
+		}
+		return 0
+	},
+	"fg": func(args []string, environment *core.Environment, out io.Writer, report io.Writer) int {
+		j, err := jobs.find(strings.Join(args, ""))
+		if err != nil {
+			fmt.Fprintf(report, "fg: %s\n", err.Error())
+			return 1
+		}
+
+		fmt.Fprintln(out, j.text)
+		if pgid := j.group(); pgid != 0 {
+			giveTerminal(pgid)
+		}
+		j.resume()
+		return waitForeground(j, report)
+	},
+	"bg": func(args []string, environment *core.Environment, out io.Writer, report io.Writer) int {
+		j, err := jobs.find(strings.Join(args, ""))
+		if err != nil {
+			fmt.Fprintf(report, "bg: %s\n", err.Error())
+			return 1
+		}
+
+		j.resume()
+		fmt.Fprintf(out, "[%d] %s &\n", j.id, j.text)
+		return 0
+	},
+	"cd": func(args []string, environment *core.Environment, out io.Writer, report io.Writer) int {
+		target, exception := changeDirectory(environment, strings.Join(args, " "))
+		if exception != nil {
+			message := exception.AsException().AsHashmap()[core.NewHashmapKey(":message", true)]
+			fmt.Fprintf(report, "cd: %s\n", message.ToString(false))
+			return 1
+		}
+
+		environment.Var("*cwd*").Set(environment.Bindings(), *core.NewString(target))
+		return 0
+	},
+	"kill": func(args []string, environment *core.Environment, out io.Writer, report io.Writer) int {
+		signal := "TERM"
+		if len(args) >= 1 && strings.HasPrefix(args[0], "-") {
+			signal, args = strings.TrimPrefix(strings.TrimPrefix(args[0], "-"), "SIG"), args[1:]
+		}
+		if len(args) == 0 {
+			fmt.Fprintln(report, "kill: usage: kill [-SIGNAL] %job|pid ...")
+			return 2
+		}
+
+		status := 0
+		for _, target := range args {
+			var err error
+			if strings.HasPrefix(target, "%") {
+				var j *job
+				if j, err = jobs.find(target); err == nil {
+					err = j.signal(signal)
+				}
+			} else if pid, perr := strconv.Atoi(target); perr == nil {
+				err = signalProcess(pid, signal)
+			} else {
+				err = errors.New(fmt.Sprintf("%s: arguments must be process or job IDs", target))
+			}
+
+			if err != nil {
+				fmt.Fprintf(report, "kill: %s\n", err.Error())
+				status = 1
+			}
+		}
+		return status
+	},
+}
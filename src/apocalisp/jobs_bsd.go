@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package apocalisp
+
+import (
+	"syscall"
+)
+
+// waitProcess reaps exited processes itself, lacking a way to only peek at
+// them, then has cmd.Wait copy their output to ports and close their pipes.
+// cmd.Wait then fails to wait for them, which is expected.
+func waitProcess(p *process, block bool) {
+	options := syscall.WUNTRACED
+	if !block {
+		options |= syscall.WNOHANG
+	}
+
+	var status syscall.WaitStatus
+	pid, err := syscall.Wait4(p.cmd.Process.Pid, &status, options, nil)
+	for err == syscall.EINTR {
+		pid, err = syscall.Wait4(p.cmd.Process.Pid, &status, options, nil)
+	}
+
+	if err != nil {
+		// somebody else reaped it
+		p.state = processDone
+	} else if pid == 0 {
+		return
+	} else if status.Stopped() {
+		p.state = processStopped
+	} else {
+		p.cmd.Wait()
+		p.state, p.status = processDone, exitStatus(status)
+	}
+}
@@ -0,0 +1,53 @@
+package apocalisp
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// waitid arguments and results missing from the syscall package
+const (
+	pPid       = 1
+	cldTrapped = 4
+	cldStopped = 5
+)
+
+func waitid(pid int, options int) (code int32, waited int32, err error) {
+	// siginfo_t: si_code is its third int, and si_pid starts its union, which
+	// is aligned like pointers
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid), uintptr(unsafe.Pointer(&info[0])), uintptr(options), 0, 0)
+	for errno == syscall.EINTR {
+		_, _, errno = syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid), uintptr(unsafe.Pointer(&info[0])), uintptr(options), 0, 0)
+	}
+	if errno != 0 {
+		return 0, 0, errno
+	}
+
+	offset := (12 + unsafe.Sizeof(uintptr(0)) - 1) &^ (unsafe.Sizeof(uintptr(0)) - 1)
+	return *(*int32)(unsafe.Pointer(&info[8])), *(*int32)(unsafe.Pointer(&info[offset])), nil
+}
+
+// waitProcess leaves exited processes to cmd.Wait, which reaps them once it
+// has copied their output to ports and closed their pipes.
+func waitProcess(p *process, block bool) {
+	options := syscall.WEXITED | syscall.WSTOPPED | syscall.WNOWAIT
+	if !block {
+		options |= syscall.WNOHANG
+	}
+
+	code, pid, err := waitid(p.cmd.Process.Pid, options)
+	if err != nil {
+		// somebody else reaped it
+		p.state = processDone
+	} else if pid == 0 {
+		return
+	} else if code == cldStopped || code == cldTrapped {
+		// the stop was only peeked at
+		waitid(p.cmd.Process.Pid, syscall.WSTOPPED|syscall.WNOHANG)
+		p.state = processStopped
+	} else {
+		p.cmd.Wait()
+		p.state, p.status = processDone, exitStatus(p.cmd.ProcessState.Sys().(syscall.WaitStatus))
+	}
+}
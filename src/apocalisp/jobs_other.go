@@ -0,0 +1,48 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package apocalisp
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// stopSignal is the signal stopping a job from the terminal, which this
+// platform lacks.
+const stopSignal = 0
+
+var errJobControl = errors.New("job control is not supported on this platform")
+
+// enableJobControl does nothing: without process groups, jobs always run
+// attached to the shell.
+func enableJobControl() {}
+
+func setProcessGroup(cmd *exec.Cmd, pgid int, foreground bool) {}
+
+func giveTerminal(pgid int) {}
+
+func takeTerminal() {}
+
+// waitProcess can only wait for processes to exit, so background jobs are
+// never reported as done.
+func waitProcess(p *process, block bool) {
+	if block {
+		p.cmd.Wait()
+		p.state, p.status = processDone, p.cmd.ProcessState.ExitCode()
+	}
+}
+
+func signalGroup(pgid int, name string) error {
+	return errJobControl
+}
+
+func signalProcess(pid int, name string) error {
+	if name != "KILL" && name != "9" {
+		return errJobControl
+	} else if process, err := os.FindProcess(pid); err != nil {
+		return err
+	} else {
+		return process.Kill()
+	}
+}
@@ -0,0 +1,131 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Jobs_Test(line string, environment *core.Environment, eoutput string, t *testing.T) {
+	out := core.NewStringOutputPort()
+	environment.Set("*out*", *out)
+	environment.Set("*err*", *out)
+
+	if err := RepShell(line, environment, Evaluate, parser.Parser{}); err != nil {
+		t.Errorf("`%s` failed: %s", line, err.Error())
+	} else if output := out.AsPort().Contents(); !strings.Contains(output, eoutput) {
+		t.Errorf("(output) `%s` should contain `%s`", output, eoutput)
+	}
+}
+
+func Test_Background_Jobs(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	Jobs_Test("sleep 10 &", environment, "[1] ", t)
+	Jobs_Test("jobs", environment, "Running\tsleep 10", t)
+
+	Jobs_Test("kill -STOP %1", environment, "", t)
+	time.Sleep(50 * time.Millisecond)
+	Jobs_Test("jobs", environment, "Stopped\tsleep 10", t)
+
+	Jobs_Test("bg %1", environment, "[1] sleep 10 &", t)
+	Jobs_Test("jobs", environment, "Running\tsleep 10", t)
+
+	Jobs_Test("kill %1", environment, "", t)
+	time.Sleep(50 * time.Millisecond)
+
+	report := core.NewStringOutputPort()
+	jobs.notify(report.AsPort().Writer())
+	if output := report.AsPort().Contents(); output != "[1] Exit 143\tsleep 10\n" {
+		t.Errorf("Finished jobs should be reported, got `%s`.", output)
+	}
+
+	Jobs_Test("jobs", environment, "", t)
+	if len(jobs.sorted()) != 0 {
+		t.Error("Reported jobs should be forgotten.")
+	}
+}
+
+func Test_Job_Control_Errors(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	Jobs_Test("fg", environment, "fg: no current job", t)
+	Jobs_Test("bg %7", environment, "bg: %7: no such job", t)
+	Jobs_Test("kill -BOGUS %1", environment, "kill: %1: no such job", t)
+	Jobs_Test("kill", environment, "kill: usage", t)
+	if status := environment.Get("*exit*"); status.ToString(true) != "2" {
+		t.Errorf("`*exit*` should be 2, got %s.", status.ToString(true))
+	}
+}
+
+func Test_Jobs_Without_A_Process_Group(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	// a background chain before its first pipeline starts
+	j := jobs.add(&job{text: "true && sleep 10", chain: &jobChain{finished: make(chan struct{})}})
+	defer func() {
+		close(j.chain.finished)
+		jobs.remove(j)
+	}()
+
+	Jobs_Test("jobs", environment, "[1] - Running\ttrue && sleep 10", t)
+	Jobs_Test("kill %1", environment, "kill: %1: no process running", t)
+	if status := environment.Get("*exit*"); status.ToString(true) != "1" {
+		t.Errorf("`*exit*` should be 1, got %s.", status.ToString(true))
+	}
+}
+
+func Test_Foreground_Jobs_Are_Waited_For(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	Jobs_Test("sh -c 'echo done; exit 5'", environment, "done\n", t)
+	if status := environment.Get("*exit*"); status.ToString(true) != "5" {
+		t.Errorf("`*exit*` should be 5, got %s.", status.ToString(true))
+	}
+	if len(jobs.sorted()) != 0 {
+		t.Error("Finished foreground jobs should be forgotten.")
+	}
+}
+
+func Test_Background_Chains_Are_One_Job(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	directory := t.TempDir()
+	skipped, run := filepath.Join(directory, "skipped.txt"), filepath.Join(directory, "run.txt")
+
+	Jobs_Test("false && echo SHOULD-NOT-RUN > "+skipped+" &", environment, "[1] false && echo SHOULD-NOT-RUN > "+skipped+" &", t)
+	Jobs_Test("sleep 0.1 && echo ran > "+run+" || echo no > "+run+" &", environment, "[2] sleep 0.1 && echo ran", t)
+	Jobs_Test("jobs", environment, "Running\tsleep 0.1 && echo ran", t)
+
+	for _, j := range jobs.sorted() {
+		j.wait()
+	}
+	report := core.NewStringOutputPort()
+	jobs.notify(report.AsPort().Writer())
+	if output := report.AsPort().Contents(); !strings.Contains(output, "[1] Exit 1\tfalse") || !strings.Contains(output, "[2] Done\tsleep 0.1") {
+		t.Errorf("Finished chains should be reported, got `%s`.", output)
+	}
+
+	if _, err := os.Stat(skipped); err == nil {
+		t.Error("`&&` after a failure in the background shouldn't have run.")
+	}
+	if contents, err := os.ReadFile(run); err != nil || string(contents) != "ran\n" {
+		t.Errorf("The background chain should have run, got `%s`, %v.", string(contents), err)
+	}
+}
+
+func Test_Finished_Background_Jobs_Copy_Their_Output(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	Jobs_Test("sh -c 'sleep 0.1; echo late' &", environment, "[1] ", t)
+	out := environment.Get("*out*")
+	for len(jobs.sorted()) != 0 {
+		time.Sleep(20 * time.Millisecond)
+		jobs.notify(out.AsPort().Writer())
+	}
+	if output := out.AsPort().Contents(); !strings.Contains(output, "late\n") || !strings.Contains(output, "[1] Done") {
+		t.Errorf("The output of finished jobs should have been copied, got `%s`.", output)
+	}
+}
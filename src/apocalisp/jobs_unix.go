@@ -0,0 +1,104 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package apocalisp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// stopSignal is the signal stopping a job from the terminal, i.e. Ctrl-Z.
+const stopSignal = int(syscall.SIGTSTP)
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"CONT": syscall.SIGCONT,
+	"STOP": syscall.SIGSTOP,
+	"TSTP": syscall.SIGTSTP,
+}
+
+// terminal is the descriptor of the controlling terminal while job control is
+// enabled, and -1 otherwise.
+var terminal = -1
+var shellPgid int
+var jobSignals = make(chan os.Signal, 1)
+
+// enableJobControl lets shell mode hand the terminal over to foreground jobs.
+// It does nothing unless stdin is a terminal.
+func enableJobControl() {
+	var pgid int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdin.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgid))); errno != 0 {
+		return
+	}
+	terminal, shellPgid = int(os.Stdin.Fd()), syscall.Getpgrp()
+
+	// the shell must not be stopped by Ctrl-Z, nor by using the terminal while
+	// a job owns it. Ignored signals would stay ignored in the jobs.
+	signal.Notify(jobSignals, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU)
+}
+
+func setProcessGroup(cmd *exec.Cmd, pgid int, foreground bool) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pgid}
+	if foreground && terminal >= 0 {
+		cmd.SysProcAttr.Foreground, cmd.SysProcAttr.Ctty = true, terminal
+	}
+}
+
+func giveTerminal(pgid int) {
+	if terminal < 0 {
+		return
+	}
+
+	// SIGTTOU is sent when a background process group takes the terminal
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Notify(jobSignals, syscall.SIGTTOU)
+
+	group := int32(pgid)
+	syscall.Syscall(syscall.SYS_IOCTL, uintptr(terminal), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&group)))
+}
+
+func takeTerminal() {
+	giveTerminal(shellPgid)
+}
+
+// exitStatus is the status of a process which exited, or 128 plus the signal
+// which killed it.
+func exitStatus(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
+
+func parseSignal(name string) (syscall.Signal, error) {
+	if number, err := strconv.Atoi(name); err == nil {
+		return syscall.Signal(number), nil
+	} else if signal, ok := signals[name]; ok {
+		return signal, nil
+	}
+	return 0, errors.New(fmt.Sprintf("%s: invalid signal specification", name))
+}
+
+func signalGroup(pgid int, name string) error {
+	return signalProcess(-pgid, name)
+}
+
+func signalProcess(pid int, name string) error {
+	if signal, err := parseSignal(name); err != nil {
+		return err
+	} else {
+		return syscall.Kill(pid, signal)
+	}
+}
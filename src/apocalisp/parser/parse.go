@@ -10,7 +10,18 @@ import (
 type Parser struct{}
 
 func (parser Parser) Parse(sexpr string) (*core.Type, error) {
-	return readForm(newReader(tokenize(sexpr)))
+	tokens, offsets := scan(sexpr)
+	reader := newReader(tokens)
+	reader.source, reader.offsets = sexpr, offsets
+	return readForm(reader)
+}
+
+// Incomplete tells whether sexpr stops in the middle of a form, e.g.
+// `(def! f (fn* (x)`, rather than being complete or invalid.
+func (parser Parser) Incomplete(sexpr string) bool {
+	reader := newReader(tokenize(sexpr))
+	reader.readAhead()
+	return reader.unterminated
 }
 
 func readForm(reader *reader) (*core.Type, error) {
@@ -47,6 +58,8 @@ func readForm(reader *reader) (*core.Type, error) {
 		return readPrefixExpansion(reader, "unquote")
 	} else if *token == "`" {
 		return readPrefixExpansion(reader, "quasiquote")
+	} else if *token == "#`" {
+		return readPrefixExpansion(reader, "syntax-quote")
 	} else if *token == "@" {
 		return readPrefixExpansion(reader, "deref")
 	} else if *token == "~@" {
@@ -96,10 +109,11 @@ func readAtom(token *string) (*core.Type, error) {
 }
 
 func readList(reader *reader) (*core.Type, error) {
+	start := reader.position - 1
 	if sequence, err := readSequence(reader); err != nil {
 		return nil, err
 	} else {
-		return &core.Type{List: sequence}, nil
+		return &core.Type{List: sequence, Source: reader.sourceOf(start)}, nil
 	}
 }
 
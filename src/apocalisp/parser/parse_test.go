@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func Benchmark_Parse(b *testing.B) {
+	contents, err := os.ReadFile("../prelude.lisp")
+	if err != nil {
+		b.Fatal(err)
+	}
+	source := "(do " + string(contents) + ")"
+
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := (Parser{}).Parse(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_Parse_Nested(b *testing.B) {
+	source := strings.Repeat("(list [1 2.5 \"three\" :four {:five 5}] ", 200) + strings.Repeat(")", 200)
+
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := (Parser{}).Parse(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
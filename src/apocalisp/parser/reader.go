@@ -1,11 +1,19 @@
 package parser
 
 import (
+	"apocalisp/core"
 	"errors"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 type reader struct {
+	// source and offsets, when set, locate tokens in the text they come from;
+	// lines holds the offset each line starts at
+	source            string
+	offsets           []int
+	lines             []int
 	position          int
 	readAheadPosition int
 	readAheadCalled   bool
@@ -13,6 +21,9 @@ type reader struct {
 	parensCount       int
 	bracketsCount     int
 	bracesCount       int
+	// unterminated is set when the tokens end inside an unclosed form or
+	// string, i.e. more input could complete them
+	unterminated bool
 }
 
 func newReader(tokens []string) *reader {
@@ -37,6 +48,29 @@ func (r *reader) next() (*string, error) {
 	}
 }
 
+// sourceOf returns the text from the token at start to the last token read,
+// or nil when the reader doesn't know the text it reads.
+func (r *reader) sourceOf(start int) *core.Source {
+	if r.offsets == nil || start < 0 || r.position < 1 || r.position > len(r.offsets) {
+		return nil
+	}
+
+	if r.lines == nil {
+		r.lines = []int{0}
+		for i, c := range r.source {
+			if c == '\n' {
+				r.lines = append(r.lines, i+1)
+			}
+		}
+	}
+
+	offset := r.offsets[start]
+	end := r.offsets[r.position-1] + len(r.tokens[r.position-1])
+	line := sort.Search(len(r.lines), func(i int) bool { return r.lines[i] > offset })
+	column := utf8.RuneCountInString(r.source[r.lines[line-1]:offset]) + 1
+	return &core.Source{Text: r.source[offset:end], Line: line, Column: column}
+}
+
 func (r *reader) readAhead() error {
 	reachedEnd := func() bool { return r.readAheadPosition == len(r.tokens) }
 	currentToken := func() string { return r.tokens[r.readAheadPosition] }
@@ -60,6 +94,7 @@ func (r *reader) readAhead() error {
 			r.bracesCount--
 		default:
 			if unclosedString(token) {
+				r.unterminated = true
 				return errors.New("Error: unexpected EOF.")
 			}
 		}
@@ -73,6 +108,7 @@ func (r *reader) readAhead() error {
 	} else if r.bracesCount < 0 {
 		return errors.New("Error: unexpected '}'.")
 	} else if reachedEnd() && (r.parensCount > 0 || r.bracketsCount > 0 || r.bracesCount > 0) {
+		r.unterminated = true
 		return errors.New("Error: unexpected EOF.")
 	}
 
@@ -72,3 +72,55 @@ func Test_Next_Should_Return_Error_If_Syntax_Is_Invalid(t *testing.T) {
 		}
 	}
 }
+
+func Test_Incomplete_Should_Detect_Unfinished_Forms(t *testing.T) {
+	mapping := map[string]bool{
+		"(def! f (fn* (x)": true,
+		"[1 2":             true,
+		"{:a (1":           true,
+		"(str \"abc":       true,
+		"(+ 1 2)":          false,
+		"(+ 1 2))":         false,
+		"]":                false,
+		"":                 false,
+		"(a ; comment (":   true,
+	}
+
+	for input, output := range mapping {
+		if (Parser{}).Incomplete(input) != output {
+			t.Error(fmt.Sprintf("Incomplete() should have returned %t for `%s`.", output, input))
+		}
+	}
+}
+
+func Test_Parse_Should_Record_The_Source_Of_Lists(t *testing.T) {
+	form, err := Parser{}.Parse("  (def! f ; comment\n  (fn* (x) \"(\" x))  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if form.Source == nil || form.Source.Text != "(def! f ; comment\n  (fn* (x) \"(\" x))" {
+		t.Errorf("Unexpected source: %#v", form.Source)
+	} else if inner := form.AsIterable()[2]; inner.Source == nil || inner.Source.Text != "(fn* (x) \"(\" x)" {
+		t.Errorf("Unexpected source: %#v", inner.Source)
+	} else if form.Source.Line != 1 || form.Source.Column != 3 || inner.Source.Line != 2 || inner.Source.Column != 3 {
+		t.Errorf("Unexpected positions: %#v %#v", form.Source, inner.Source)
+	}
+}
+
+func Test_Parse_Should_Read_Syntax_Quote(t *testing.T) {
+	mapping := map[string]string{
+		"#`(a ~b ~@c)": "(syntax-quote (a (unquote b) (splice-unquote c)))",
+		"`(a# b)":      "(quasiquote (a# b))",
+		"(a# #`b)":     "(a# (syntax-quote b))",
+	}
+
+	for input, output := range mapping {
+		form, err := Parser{}.Parse(input)
+		if err != nil {
+			t.Error(err)
+		} else if form.ToString(true) != output {
+			t.Error(fmt.Sprintf("Input `%s` should have been read as `%s`, got `%s`.", input, output, form.ToString(true)))
+		}
+	}
+}
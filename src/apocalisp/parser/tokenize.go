@@ -5,15 +5,23 @@ import (
 )
 
 func tokenize(sexpr string) []string {
-	re := regexp.MustCompile(`[\s,]*(~@|[\[\]{}()'` + "`" +
+	tokens, _ := scan(sexpr)
+	return tokens
+}
+
+// scan splits sexpr into tokens, also returning the offset each token starts
+// at.
+func scan(sexpr string) ([]string, []int) {
+	re := regexp.MustCompile(`[\s,]*(~@|#` + "`" + `|[\[\]{}()'` + "`" +
 		`~^@]|"(?:\\.|[^\\"])*"?|;.*|[^\s\[\]{}('"` + "`" +
 		`,;)]*)`)
-	rawTokens := []string{}
-	for _, group := range re.FindAllStringSubmatch(sexpr, -1) {
-		if (group[1] == "") || (group[1][0] == ';') {
+	rawTokens, offsets := []string{}, []int{}
+	for _, group := range re.FindAllStringSubmatchIndex(sexpr, -1) {
+		if token := sexpr[group[2]:group[3]]; (token == "") || (token[0] == ';') {
 			continue
+		} else {
+			rawTokens, offsets = append(rawTokens, token), append(offsets, group[2])
 		}
-		rawTokens = append(rawTokens, group[1])
 	}
 
 	tokens := []string{}
@@ -32,5 +40,5 @@ func tokenize(sexpr string) []string {
 		}
 	}
 
-	return tokens
+	return tokens, offsets
 }
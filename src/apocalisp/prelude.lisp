@@ -0,0 +1,232 @@
+;; The core prelude, evaluated by DefaultEnvironment after the builtins are
+;; defined.
+
+(def! not
+  "Returns true if x is false or nil, false otherwise."
+  (fn* (x) (if x false true)))
+
+(def! load-file
+  "Evaluates every form of the file at path."
+  (fn* (path)
+    (let* [contents (slurp path)]
+      (binding [*file* path]
+        (eval (read-string (str "(do " contents "\nnil)")))))))
+
+(defmacro! cond
+  "Evaluates the expression following the first test that is truthy:
+(cond test expr ...)."
+  (fn* (& clauses)
+    (if (> (count clauses) 0)
+      (list 'if (first clauses)
+            (if (> (count clauses) 1)
+              (nth clauses 1)
+              (throw "odd number of forms to cond"))
+            (cons 'cond (rest (rest clauses)))))))
+
+;; definitions
+
+(defmacro! defmacro
+  "Defines a macro: (defmacro name docstring? [params] body...)."
+  (fn* (name & decl)
+    (if (string? (first decl))
+      #`(defmacro! ~name ~(first decl) (fn* ~(nth decl 1) (do ~@(rest (rest decl)))))
+      #`(defmacro! ~name (fn* ~(first decl) (do ~@(rest decl)))))))
+
+(defmacro defn
+  "Defines a function: (defn name docstring? [params] body...)."
+  [name & decl]
+  (if (string? (first decl))
+    #`(def! ~name ~(first decl) (fn* ~(nth decl 1) (do ~@(rest (rest decl)))))
+    #`(def! ~name (fn* ~(first decl) (do ~@(rest decl))))))
+
+(defmacro fn
+  "Creates a function: (fn name? [params] body...). The name lets the
+function call itself."
+  [& decl]
+  (if (symbol? (first decl))
+    #`(let* [~(first decl) (fn ~@(rest decl))] ~(first decl))
+    #`(fn* ~(first decl) (do ~@(rest decl)))))
+
+(defmacro let
+  "Binds names sequentially, then evaluates body: (let [name value ...] body...)."
+  [bindings & body]
+  #`(let* ~bindings (do ~@body)))
+
+;; conditionals
+
+(defmacro when
+  "Evaluates body if test is truthy."
+  [test & body]
+  #`(if ~test (do ~@body)))
+
+(defmacro when-not
+  "Evaluates body if test is false or nil."
+  [test & body]
+  #`(if ~test nil (do ~@body)))
+
+(defmacro if-let
+  "Evaluates then with name bound to the value of test if it's truthy, else
+otherwise: (if-let [name test] then else?)."
+  [bindings then & else]
+  #`(let* [value# ~(nth bindings 1)]
+     (if value#
+       (let* [~(first bindings) value#] ~then)
+       ~(first else))))
+
+(defmacro when-let
+  "Evaluates body with name bound to the value of test if it's truthy:
+(when-let [name test] body...)."
+  [bindings & body]
+  #`(if-let ~bindings (do ~@body)))
+
+(defmacro and
+  "Evaluates exprs from left to right, returning the first falsy value or
+the last one."
+  [& exprs]
+  (cond (empty? exprs) true
+        (= 1 (count exprs)) (first exprs)
+        "else" #`(let* [and# ~(first exprs)]
+                  (if and# (and ~@(rest exprs)) and#))))
+
+(defmacro or
+  "Evaluates exprs from left to right, returning the first truthy value or
+the last one."
+  [& exprs]
+  (cond (empty? exprs) nil
+        (= 1 (count exprs)) (first exprs)
+        "else" #`(let* [or# ~(first exprs)]
+                  (if or# or# (or ~@(rest exprs))))))
+
+(defmacro case
+  "Evaluates the expression following the constant equal to the value of
+expr: (case expr constant result ... default?). A list of constants matches
+any of them."
+  [expr & clauses]
+  (let [value (gensym "case")
+        expand (fn* (clauses)
+                 (cond (empty? clauses) #`(throw (str "No matching clause: " ~value))
+                       (= 1 (count clauses)) (first clauses)
+                       "else" (let [constant (first clauses)
+                                    test (if (list? constant)
+                                           #`(or ~@(map (fn* (c) #`(= ~value '~c)) constant))
+                                           #`(= ~value '~constant))]
+                                #`(if ~test ~(nth clauses 1) ~(expand (rest (rest clauses)))))))]
+    #`(let* [~value ~expr] ~(expand clauses))))
+
+(defmacro condp
+  "Evaluates the expression following the first test for which
+(pred test expr) is truthy: (condp pred expr test result ... default?)."
+  [pred expr & clauses]
+  (let [p (gensym "pred")
+        value (gensym "condp")
+        expand (fn* (clauses)
+                 (cond (empty? clauses) #`(throw (str "No matching clause: " ~value))
+                       (= 1 (count clauses)) (first clauses)
+                       "else" #`(if (~p ~(first clauses) ~value)
+                                 ~(nth clauses 1)
+                                 ~(expand (rest (rest clauses))))))]
+    #`(let* [~p ~pred ~value ~expr] ~(expand clauses))))
+
+;; threading
+
+(defmacro ->
+  "Threads x through forms as their first argument."
+  [x & forms]
+  (if (empty? forms)
+    x
+    (let [form (first forms)]
+      #`(-> ~(if (list? form) #`(~(first form) ~x ~@(rest form)) (list form x))
+           ~@(rest forms)))))
+
+(defmacro ->>
+  "Threads x through forms as their last argument."
+  [x & forms]
+  (if (empty? forms)
+    x
+    (let [form (first forms)]
+      #`(->> ~(if (list? form) #`(~@form ~x) (list form x))
+            ~@(rest forms)))))
+
+(defmacro as->
+  "Binds name to expr, then to the value of each form in turn."
+  [expr name & forms]
+  #`(let* [~name ~expr ~@(apply concat (map (fn* (form) [name form]) forms))] ~name))
+
+(defmacro doto
+  "Calls each form with x as its first argument, then returns x."
+  [x & forms]
+  (let [value (gensym "doto")]
+    #`(let* [~value ~x]
+       (do ~@(map (fn* (form) (if (list? form) #`(~(first form) ~value ~@(rest form)) (list form value))) forms)
+           ~value))))
+
+;; iteration
+
+(defmacro dotimes
+  "Evaluates body with name bound to 0 up to n - 1: (dotimes [name n] body...)."
+  [bindings & body]
+  (let [name (first bindings)]
+    #`(let* [n# ~(nth bindings 1)
+            loop# (fn* (~name)
+                    (if (< ~name n#)
+                      (do ~@body (loop# (+ ~name 1)))))]
+       (loop# 0))))
+
+(defmacro doseq
+  "Evaluates body for each element of coll, for side effects:
+(doseq [name coll ...] body...). Further pairs nest."
+  [bindings & body]
+  (if (> (count bindings) 2)
+    #`(doseq ~[(first bindings) (nth bindings 1)] (doseq ~(vec (rest (rest bindings))) ~@body))
+    #`(let* [loop# (fn* (coll#)
+                    (if (not (empty? coll#))
+                      (let* [~(first bindings) (first coll#)]
+                        (do ~@body (loop# (rest coll#))))))]
+       (loop# ~(nth bindings 1)))))
+
+(defmacro for
+  "List comprehension: (for [name coll ...] expr). Pairs nest; :when test
+filters and :let [name value ...] binds names."
+  [bindings expr]
+  (let [expand (fn* (bindings)
+                 (if (empty? bindings)
+                   #`(list ~expr)
+                   (let [k (first bindings) v (nth bindings 1) more (rest (rest bindings))]
+                     (cond (= k :when) #`(if ~v ~(expand more) ())
+                           (= k :let) #`(let* ~v ~(expand more))
+                           "else" #`(apply concat (map (fn* (~k) ~(expand more)) ~v))))))]
+    (expand bindings)))
+
+;; introspection
+
+(defmacro doc
+  "Prints the docstring given to the definition of name."
+  [name]
+  #`(print-doc (var ~name)))
+
+(defmacro source
+  "Prints the form that defined name."
+  [name]
+  #`(print-source (var ~name)))
+
+;; profiling
+
+(defmacro time
+  "Evaluates expr, printing how long it took and how much it allocated, then
+returns its value."
+  [expr]
+  #`(time* (runtime-stats) ~expr))
+
+;; concurrency
+
+(defmacro future
+  "Evaluates body in a goroutine, returning a future: deref waits for the
+value of body."
+  [& body]
+  #`(future-call (fn* () (do ~@body))))
+
+(defmacro go
+  "Evaluates body in a goroutine, returning a channel receiving its value
+unless it's nil."
+  [& body]
+  #`(go-call (fn* () (do ~@body))))
@@ -0,0 +1,63 @@
+package apocalisp
+
+import (
+	"testing"
+)
+
+func Test_Prelude_Definitions(t *testing.T) {
+	Repl_Test(`(do (defn twice "Doubles x." [x] (* 2 x)) (twice 21))`, `42`, t)
+	Repl_Test(`(do (defn twice "Doubles x." [x] (* 2 x)) (with-out-str (doc twice)))`, `"-------------------------\ntwice\n([x])\n  Doubles x.\n"`, t)
+	Repl_Test(`(do (defn twice [x] (* 2 x)) (with-out-str (source twice)))`, `"(defn twice [x] (* 2 x))\n"`, t)
+	Repl_Test(`(do (defmacro unless [test & body] (list 'if test nil (cons 'do body))) (unless false 1 2))`, `2`, t)
+	Repl_Test(`((fn [x y] (+ x y)) 1 2)`, `3`, t)
+	Repl_Test(`((fn fact [n] (if (< n 2) 1 (* n (fact (- n 1))))) 5)`, `120`, t)
+	Repl_Test(`(let [x 1 y (+ x 1)] (def! z 3) (+ x y z))`, `6`, t)
+	Repl_Test(`(get (meta (var defn)) :file)`, `"prelude.lisp"`, t)
+}
+
+func Test_Prelude_Conditionals(t *testing.T) {
+	Repl_Test(`[(when true 1 2) (when false 1)]`, `[2 nil]`, t)
+	Repl_Test(`[(when-not false 1 2) (when-not true 1)]`, `[2 nil]`, t)
+	Repl_Test(`[(if-let [x 1] (+ x 1) 0) (if-let [x nil] x :none) (if-let [x false] x)]`, `[2 :none nil]`, t)
+	Repl_Test(`[(when-let [x 2] 1 (* x 2)) (when-let [x nil] 1)]`, `[4 nil]`, t)
+	Repl_Test(`[(and) (and 1 2) (and 1 nil 2) (and false (throw "unreached"))]`, `[true 2 nil false]`, t)
+	Repl_Test(`[(or) (or nil 2) (or nil false) (or 1 (throw "unreached"))]`, `[nil 2 false 1]`, t)
+	Repl_Test(`(map (fn [x] (case x 1 :one (2 3) :few "a" :string :many)) [1 2 3 "a" 4])`, `(:one :few :few :string :many)`, t)
+	Repl_Test(`(try* (case 5 1 :one) (catch* e e))`, `"No matching clause: 5"`, t)
+	Repl_Test(`(condp = 2 1 :one 2 :two :other)`, `:two`, t)
+	Repl_Test(`(condp < 5 10 :big 3 :medium :small)`, `:medium`, t)
+	Repl_Test(`(cond false 1 nil 2 :else 3)`, `3`, t)
+	Repl_Test(`(not nil)`, `true`, t)
+}
+
+func Test_Prelude_Threading(t *testing.T) {
+	Repl_Test(`(-> 5 (- 2) (* 3) str)`, `"9"`, t)
+	Repl_Test(`(->> [1 2 3] (map (fn [x] (* x x))) (apply +))`, `14`, t)
+	Repl_Test(`(as-> 2 x (+ x 1) (* x x) (- 20 x))`, `11`, t)
+	Repl_Test(`(deref (doto (atom 1) (swap! + 1) (swap! * 10)))`, `20`, t)
+}
+
+func Test_Prelude_Iteration(t *testing.T) {
+	Repl_Test(`(let [a (atom [])] (dotimes [i 4] (swap! a conj i)) @a)`, `[0 1 2 3]`, t)
+	Repl_Test(`(let [a (atom 0)] (dotimes [i 10000] (swap! a + i)) @a)`, `49995000`, t)
+	Repl_Test(`(with-out-str (doseq [x [1 2] y ["a" "b"]] (println x y)))`, `"1 a\n1 b\n2 a\n2 b\n"`, t)
+	Repl_Test(`(doseq [x []] (throw "unreached"))`, `nil`, t)
+	Repl_Test(`(for [x [1 2 3]] (* x 10))`, `(10 20 30)`, t)
+	Repl_Test(`(for [x [1 2 3] y [:a :b] :when (not (= x 2))] [x y])`, `([1 :a] [1 :b] [3 :a] [3 :b])`, t)
+	Repl_Test(`(for [x [1 2] :let [y (* x x)]] y)`, `(1 4)`, t)
+}
+
+func Test_Prelude_Profiling(t *testing.T) {
+	Repl_Test(`(macroexpand (time (+ 1 2)))`, `(user/time* (user/runtime-stats) (+ 1 2))`, t)
+}
+
+func Test_Prelude_Macros_Are_Hygienic(t *testing.T) {
+	Repl_Test(`(with-out-str (let* [rest 5 first 6] (doseq [x [1 2]] (prn x))))`, `"1\n2\n"`, t)
+	Repl_Test(`(let* [runtime-stats 1] (first (seq (with-out-str (time 1)))))`, `"E"`, t)
+	Repl_Test(`(let* [concat 1 cons 2] [(-> 1 (+ 1) (list 3)) (->> 1 (list 2))])`, `[(2 3) (2 1)]`, t)
+	Repl_Test(`(let* [not 1 < 2 + 3] (let [a (atom 0)] (dotimes [i 3] (swap! a - i)) @a))`, `-3`, t)
+	Repl_Test(`(let* [apply 1 map 2 list 3] (for [x [1 2] :when (> x 1)] x))`, `(2)`, t)
+	Repl_Test(`(let* [if-let 1] (when-let [x 2] x))`, `2`, t)
+	Repl_Test(`(let* [future-call 1] @(future 2))`, `2`, t)
+	Repl_Test(`(let* [go-call 1] (<! (go 2)))`, `2`, t)
+}
@@ -0,0 +1,89 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// started is when the interpreter started, so elapsed times fit in numbers.
+var started = time.Now()
+
+// runtimeStats are the time elapsed since the interpreter started, and the
+// heap allocations made so far.
+type runtimeStats struct {
+	elapsed     time.Duration
+	allocations uint64
+	bytes       uint64
+}
+
+func currentStats() runtimeStats {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	return runtimeStats{elapsed: time.Since(started), allocations: memory.Mallocs, bytes: memory.TotalAlloc}
+}
+
+func (stats runtimeStats) toHashmap() core.Type {
+	hashmap := *core.NewHashmap()
+	hashmap.HashmapSet(core.NewHashmapKey(":elapsed-ns", true), *core.NewNumber(float64(stats.elapsed.Nanoseconds())))
+	hashmap.HashmapSet(core.NewHashmapKey(":allocations", true), *core.NewNumber(float64(stats.allocations)))
+	hashmap.HashmapSet(core.NewHashmapKey(":allocated-bytes", true), *core.NewNumber(float64(stats.bytes)))
+	return hashmap
+}
+
+func statsFromHashmap(hashmap core.Type) (runtimeStats, bool) {
+	values := make([]float64, 0)
+	for _, key := range []string{":elapsed-ns", ":allocations", ":allocated-bytes"} {
+		value, ok := hashmap.AsHashmap()[core.NewHashmapKey(key, true)]
+		if !ok || !value.IsNumber() {
+			return runtimeStats{}, false
+		}
+		number, _ := value.AsNumber().Float64()
+		values = append(values, number)
+	}
+	return runtimeStats{elapsed: time.Duration(values[0]), allocations: uint64(values[1]), bytes: uint64(values[2])}, true
+}
+
+func timeReport(start runtimeStats) string {
+	now := currentStats()
+	return fmt.Sprintf("Elapsed time: %.3f msecs, %d allocations, %d bytes",
+		float64(now.elapsed-start.elapsed)/float64(time.Millisecond), now.allocations-start.allocations, now.bytes-start.bytes)
+}
+
+// profiled reports how long each evaluation takes and how much it allocates
+// to report.
+func profiled(eval func(*core.Type, *core.Environment) (*core.Type, error), report io.Writer) func(*core.Type, *core.Environment) (*core.Type, error) {
+	return func(node *core.Type, environment *core.Environment) (*core.Type, error) {
+		start := currentStats()
+		defer func() {
+			fmt.Fprintln(report, timeReport(start))
+		}()
+		return eval(node, environment)
+	}
+}
+
+func defineProfiling(environment *core.Environment) {
+	environment.SetCallable("runtime-stats", func(args ...core.Type) core.Type {
+		return currentStats().toHashmap()
+	})
+
+	// used by `time`: the value is evaluated between the two calls
+	environment.SetCallableWithBindings("time*", func(bindings *core.Bindings, args ...core.Type) core.Type {
+		caller := environment.WithBindings(bindings)
+		var start runtimeStats
+		ok := len(args) == 2 && args[0].IsHashmap()
+		if ok {
+			start, ok = statsFromHashmap(args[0])
+		}
+		if !ok {
+			return argumentException("time*", "expects the stats returned by `runtime-stats` and a value.")
+		}
+
+		if result := writeLine(caller, "*out*", timeReport(start)); result.IsException() {
+			return result
+		}
+		return args[1]
+	})
+}
@@ -0,0 +1,47 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_Runtime_Stats(t *testing.T) {
+	Repl_Test(`(let* [stats (runtime-stats)] (map (fn* (k) (number? (get stats k))) [:elapsed-ns :allocations :allocated-bytes]))`, `(true true true)`, t)
+	Repl_Test(`(let* [a (runtime-stats) b (runtime-stats)] (<= (get a :allocations) (get b :allocations)))`, `true`, t)
+	Repl_Test(`(try* (time* {} 1) (catch* e (get e :type)))`, `:argument-error`, t)
+}
+
+func Test_Time(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	Rep(`(def! report (with-out-str (def! value (time (do (def! defined 2) (+ 1 defined))))))`, environment, Evaluate, parser.Parser{})
+
+	report, value := environment.Get("report"), environment.Get("value")
+	if !regexp.MustCompile(`^Elapsed time: \d+\.\d{3} msecs, \d+ allocations, \d+ bytes\n$`).MatchString(report.ToString(false)) {
+		t.Errorf("Unexpected report `%s`.", report.ToString(false))
+	}
+	if value.ToString(true) != "3" {
+		t.Errorf("(value) `%s` != `3` (expected)", value.ToString(true))
+	}
+	if environment.Find("defined") == nil {
+		t.Error("`time` should evaluate its expression where it's used.")
+	}
+}
+
+func Test_Profiled_Evaluation(t *testing.T) {
+	calls := 0
+	report := &strings.Builder{}
+	eval := profiled(func(node *core.Type, environment *core.Environment) (*core.Type, error) {
+		calls++
+		return Evaluate(node, environment)
+	}, report)
+
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	if output, err := Rep(`(+ 1 2)`, environment, eval, parser.Parser{}); err != nil || output != "3" || calls != 1 {
+		t.Errorf("Unexpected profiled evaluation: %s, %v, %d calls", output, err, calls)
+	} else if !strings.HasPrefix(report.String(), "Elapsed time: ") {
+		t.Errorf("The evaluation should have been reported, got `%s`.", report.String())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"apocalisp/core"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 func Rep(sexpr string, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) (string, error) {
@@ -31,7 +32,9 @@ func NoEval(node *core.Type, environment *core.Environment) (*core.Type, error)
 	return node, nil
 }
 
-func Evaluate(node *core.Type, environment *core.Environment) (*core.Type, error) {
+// Interpret evaluates node by walking it directly. It is the reference for
+// Evaluate, which compiles forms first.
+func Interpret(node *core.Type, environment *core.Environment) (*core.Type, error) {
 	var lexicalReturnValue *core.Type
 	var lexicalError error
 	processReturn := func() (*core.Type, error) {
@@ -56,49 +59,77 @@ func Evaluate(node *core.Type, environment *core.Environment) (*core.Type, error
 			return processReturn()
 		}
 
-		expanded := macroexpand(*node, *environment)
+		expanded := macroexpand(*node, environment)
 		node = &expanded
 
 		if !node.IsList() {
-			wrapReturn(evalAst(node, environment, Evaluate))
+			wrapReturn(evalAst(node, environment, Interpret))
 		} else if node.IsList() && node.IsEmptyIterable() {
 			wrapReturn(node, nil)
 		} else if node.IsList() && !node.IsEmptyIterable() {
 			first, rest := node.AsIterable()[0], node.AsIterable()[1:]
 
 			if first.CompareSymbol("def!") {
-				wrapReturn(specialFormDef(Evaluate, rest, environment))
+				wrapReturn(specialFormDef(Interpret, rest, environment, node.Source))
 			} else if first.CompareSymbol("defmacro!") {
-				wrapReturn(specialFormDefmacro(Evaluate, rest, environment))
+				wrapReturn(specialFormDefmacro(Interpret, rest, environment, node.Source))
+			} else if first.CompareSymbol("def-dynamic!") {
+				wrapReturn(specialFormDefDynamic(Interpret, rest, environment, node.Source))
 			} else if first.CompareSymbol("macroexpand") {
-				expanded := macroexpand(rest[0], *environment)
+				expanded := macroexpand(rest[0], environment)
 				wrapReturn(&expanded, nil)
+			} else if first.CompareSymbol("macroexpand-1") {
+				wrapReturn(specialFormMacroexpand1(Interpret, rest, environment))
+			} else if first.CompareSymbol("macroexpand-all") {
+				wrapReturn(specialFormMacroexpandAll(Interpret, rest, environment))
+			} else if first.CompareSymbol("macrostep") {
+				wrapReturn(specialFormMacrostep(Interpret, rest, environment))
 			} else if first.CompareSymbol("let*") {
-				wrapReturn(tcoSpecialFormLet(Evaluate, rest, &node, &environment))
+				wrapReturn(tcoSpecialFormLet(Interpret, rest, &node, &environment))
 			} else if first.CompareSymbol("do") {
-				wrapReturn(tcoSpecialFormDo(Evaluate, rest, &node, &environment))
+				wrapReturn(tcoSpecialFormDo(Interpret, rest, &node, &environment))
 			} else if first.CompareSymbol("fn*", `\`) {
-				wrapReturn(tcoSpecialFormFn(Evaluate, rest, &node, &environment))
+				wrapReturn(tcoSpecialFormFn(Interpret, rest, &node, &environment))
 			} else if first.CompareSymbol("if") {
-				wrapReturn(tcoSpecialFormIf(Evaluate, rest, &node, &environment))
+				wrapReturn(tcoSpecialFormIf(Interpret, rest, &node, &environment))
 			} else if first.CompareSymbol("quasiquote") {
-				wrapReturn(tcoSpecialFormQuasiquote(Evaluate, rest, &node, &environment))
+				wrapReturn(tcoSpecialFormQuasiquote(Interpret, rest, &node, &environment))
+			} else if first.CompareSymbol("syntax-quote") {
+				wrapReturn(tcoSpecialFormSyntaxQuote(Interpret, rest, &node, &environment))
 			} else if first.CompareSymbol("quasiquoteexpand") {
-				wrapReturn(specialFormQuasiquoteexpand(Evaluate, rest, environment))
+				wrapReturn(specialFormQuasiquoteexpand(Interpret, rest, environment))
 			} else if first.CompareSymbol("quote") {
-				wrapReturn(specialFormQuote(Evaluate, rest, environment))
+				wrapReturn(specialFormQuote(Interpret, rest, environment))
 			} else if first.CompareSymbol("try*") {
-				wrapReturn(specialFormTryCatch(Evaluate, rest, environment))
+				wrapReturn(specialFormTryCatch(Interpret, rest, environment))
+			} else if first.CompareSymbol("with-open") {
+				wrapReturn(specialFormWithOpen(Interpret, rest, environment))
+			} else if first.CompareSymbol("binding") {
+				wrapReturn(specialFormBinding(Interpret, rest, environment))
+			} else if first.CompareSymbol("set!") {
+				wrapReturn(specialFormSet(Interpret, rest, environment))
+			} else if first.CompareSymbol("with-env") {
+				wrapReturn(specialFormWithEnv(Interpret, rest, environment))
+			} else if first.CompareSymbol("with-cwd") {
+				wrapReturn(specialFormWithCwd(Interpret, rest, environment))
+			} else if first.CompareSymbol("var") {
+				wrapReturn(specialFormVar(Interpret, rest, environment))
+			} else if first.CompareSymbol("with-out-str") {
+				wrapReturn(specialFormWithOutStr(Interpret, rest, environment))
+			} else if first.CompareSymbol("with-in-str") {
+				wrapReturn(specialFormWithInStr(Interpret, rest, environment))
 			} else {
-				if container, err := evalAst(node, environment, Evaluate); err != nil {
+				if container, err := evalAst(node, environment, Interpret); err != nil {
 					wrapReturn(nil, err)
 				} else {
 					function, parameters := container.AsIterable()[0], container.AsIterable()[1:]
 					if function.IsFunction() {
 						node = &function.Function.Body
-						environment = core.NewEnvironment(&function.Function.Environment, function.Function.Params, parameters)
+						callEnvironment := core.NewEnvironment(function.Function.Environment, function.Function.Params, parameters)
+						callEnvironment.SetBindings(environment.Bindings())
+						environment = callEnvironment
 					} else {
-						wrapReturn(evalCallable(container))
+						wrapReturn(evalCallable(container, environment.Bindings()))
 					}
 				}
 			}
@@ -182,8 +213,9 @@ func tcoSpecialFormFn(eval func(*core.Type, *core.Environment) (*core.Type, erro
 			}
 		}
 
-		callable := func(args ...core.Type) core.Type {
+		callable := func(bindings *core.Bindings, args ...core.Type) core.Type {
 			newEnvironment := core.NewEnvironment(*environment, symbols, args)
+			newEnvironment.SetBindings(bindings)
 			if result, err := eval(&rest[1], newEnvironment); err != nil {
 				return *core.NewStringException(err.Error())
 			} else {
@@ -195,7 +227,7 @@ func tcoSpecialFormFn(eval func(*core.Type, *core.Environment) (*core.Type, erro
 			Params:      symbols,
 			Body:        rest[1],
 			Callable:    callable,
-			Environment: **environment,
+			Environment: *environment,
 		}
 
 		return &core.Type{Function: &function}, nil
@@ -220,6 +252,32 @@ func specialFormQuote(eval func(*core.Type, *core.Environment) (*core.Type, erro
 	}
 }
 
+func tcoSpecialFormSyntaxQuote(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, node **core.Type, environment **core.Environment) (*core.Type, error) {
+	if len(rest) < 1 {
+		return nil, errors.New("Error: Invalid syntax for `syntax-quote`.")
+	} else {
+		newNode := syntaxQuote(rest[0], *environment)
+		*node = &newNode
+	}
+	return nil, nil
+}
+
+func specialFormMacroexpand1(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) != 1 {
+		return nil, errors.New("Error: Invalid syntax for `macroexpand-1`.")
+	}
+	expanded, _ := macroexpand1(rest[0], environment)
+	return &expanded, nil
+}
+
+func specialFormMacroexpandAll(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) != 1 {
+		return nil, errors.New("Error: Invalid syntax for `macroexpand-all`.")
+	}
+	expanded := macroexpandAll(rest[0], environment)
+	return &expanded, nil
+}
+
 func specialFormQuasiquoteexpand(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
 	if len(rest) >= 1 {
 		newNode := quasiquote(rest[0])
@@ -228,49 +286,101 @@ func specialFormQuasiquoteexpand(eval func(*core.Type, *core.Environment) (*core
 	return nil, errors.New("Error: Invalid syntax for `quasiquoteexpand`.")
 }
 
-func specialFormDef(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
-	if len(rest) != 2 || !rest[0].IsSymbol() {
+// isDefinition checks the syntax of `(def! name value)`, where a docstring
+// may come before the value.
+func isDefinition(rest []core.Type) bool {
+	return (len(rest) == 2 || (len(rest) == 3 && rest[1].IsString())) && rest[0].IsSymbol()
+}
+
+// specialFormDef binds a symbol, describing the binding in its metadata: see
+// definitionMetadata.
+func specialFormDef(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment, source *core.Source) (*core.Type, error) {
+	if !isDefinition(rest) {
 		return nil, errors.New("Error: Invalid syntax for `def!`.")
 	} else {
-		if e, ierr := eval(&rest[1], environment); ierr != nil {
+		if e, ierr := eval(&rest[len(rest)-1], environment); ierr != nil {
 			return nil, ierr
 		} else if e.IsException() {
 			return e, nil
 		} else {
 			environment.Set(rest[0].AsSymbol(), *e)
+			environment.SetMetadata(rest[0].AsSymbol(), definitionMetadata(rest, *e, source, environment))
 			return e, nil
 		}
 	}
 }
 
-func specialFormDefmacro(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+// specialFormDefDynamic defines a dynamic variable in the outermost
+// environment, like `def!` there.
+func specialFormDefDynamic(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment, source *core.Source) (*core.Type, error) {
+	if !isDefinition(rest) {
+		return nil, errors.New("Error: Invalid syntax for `def-dynamic!`.")
+	} else if e, ierr := eval(&rest[len(rest)-1], environment); ierr != nil {
+		return nil, ierr
+	} else if e.IsException() {
+		return e, nil
+	} else {
+		symbol := rest[0].AsSymbol()
+		environment.DefineDynamic(symbol, *e)
+		metadata := definitionMetadata(rest, *e, source, environment)
+		metadata.HashmapSet(core.NewHashmapKey(":dynamic", true), *core.NewBoolean(true))
+		environment.Root().SetMetadata(symbol, metadata)
+		return e, nil
+	}
+}
+
+// specialFormSet changes the value of a dynamic variable within `binding`,
+// for the rest of its body.
+func specialFormSet(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
 	if len(rest) != 2 || !rest[0].IsSymbol() {
+		return nil, errors.New("Error: Invalid syntax for `set!`.")
+	}
+
+	symbol := rest[0].AsSymbol()
+	v := environment.Var(symbol)
+	if v == nil {
+		return bindingException("Can't set! '%s', which isn't a dynamic variable.", symbol), nil
+	}
+
+	if e, err := eval(&rest[1], environment); err != nil {
+		return nil, err
+	} else if e.IsException() {
+		return e, nil
+	} else if !v.SetBound(environment.Bindings(), *e) {
+		return bindingException("Can't set! '%s' outside of a `binding`.", symbol), nil
+	} else {
+		return e, nil
+	}
+}
+
+func specialFormDefmacro(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment, source *core.Source) (*core.Type, error) {
+	if !isDefinition(rest) {
 		return nil, errors.New("Error: Invalid syntax for `defmacro!`.")
 	} else {
-		if e, ierr := eval(&rest[1], environment); ierr != nil {
+		if e, ierr := eval(&rest[len(rest)-1], environment); ierr != nil {
 			return nil, ierr
 		} else if e.IsException() {
 			return e, nil
 		} else {
-			var macro *core.Type
-			if e.IsFunction() {
-				newFunction := core.Function{
-					IsMacro:     true,
-					Environment: e.Function.Environment,
-					Body:        e.Function.Body,
-					Params:      e.Function.Params,
-					Callable:    e.Function.Callable,
-				}
-				macro = &core.Type{Function: &newFunction, Metadata: e.Metadata}
-			} else {
-				macro = e
-			}
+			macro := newMacro(e)
 			environment.Set(rest[0].AsSymbol(), *macro)
+			environment.SetMetadata(rest[0].AsSymbol(), definitionMetadata(rest, *macro, source, environment))
 			return macro, nil
 		}
 	}
 }
 
+// newMacro returns a macro calling the same function as e, or e itself if it
+// isn't a function.
+func newMacro(e *core.Type) *core.Type {
+	if !e.IsFunction() {
+		return e
+	}
+	newFunction := *e.Function
+	newFunction.IsMacro = true
+	return &core.Type{Function: &newFunction, Metadata: e.Metadata}
+}
+
 func specialFormTryCatch(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
 	if len(rest) < 1 {
 		return nil, errors.New("Error: Invalid syntax for `try*!`.")
@@ -291,11 +401,167 @@ func specialFormTryCatch(eval func(*core.Type, *core.Environment) (*core.Type, e
 	return e, nil
 }
 
-func evalCallable(node *core.Type) (*core.Type, error) {
+func specialFormWithOpen(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) < 1 || !rest[0].IsEvenIterable() {
+		return nil, errors.New("Error: Invalid syntax for `with-open`.")
+	}
+
+	openEnvironment := core.NewEnvironment(environment, []string{}, []core.Type{})
+	bindings, ports := rest[0].AsIterable(), make([]*core.Port, 0)
+
+	// ports are closed in reverse order, however the body exits
+	defer func() {
+		for i := len(ports) - 1; i >= 0; i-- {
+			ports[i].Close()
+		}
+	}()
+
+	for symbol, target := 0, 1; symbol < len(bindings); symbol, target = symbol+2, target+2 {
+		if e, ierr := eval(&bindings[target], openEnvironment); ierr != nil {
+			return nil, ierr
+		} else if e.IsException() {
+			return e, nil
+		} else if !e.IsPort() {
+			return nil, errors.New("Error: `with-open` can only bind ports.")
+		} else {
+			ports = append(ports, e.AsPort())
+			openEnvironment.Set(bindings[symbol].ToString(true), *e)
+		}
+	}
+
+	if len(rest) == 1 {
+		return core.NewNil(), nil
+	}
+	return eval(core.NewList(append([]core.Type{*core.NewSymbol("do")}, rest[1:]...)...), openEnvironment)
+}
+
+func specialFormBinding(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) < 1 || !rest[0].IsEvenIterable() {
+		return nil, errors.New("Error: Invalid syntax for `binding`.")
+	}
+
+	bindings := rest[0].AsIterable()
+	symbols, values := make([]string, 0), make([]core.Type, 0)
+
+	// every value is evaluated before any of the bindings takes effect
+	for symbol, target := 0, 1; symbol < len(bindings); symbol, target = symbol+2, target+2 {
+		if !bindings[symbol].IsSymbol() {
+			return nil, errors.New("Error: Invalid syntax for `binding`.")
+		} else if e, ierr := eval(&bindings[target], environment); ierr != nil {
+			return nil, ierr
+		} else if e.IsException() {
+			return e, nil
+		} else {
+			symbols, values = append(symbols, bindings[symbol].AsSymbol()), append(values, *e)
+		}
+	}
+
+	return withBindings(eval, symbols, values, rest[1:], environment)
+}
+
+func specialFormWithOutStr(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	port := core.NewStringOutputPort()
+
+	if e, err := withBindings(eval, []string{"*out*"}, []core.Type{*port}, rest, environment); err != nil {
+		return nil, err
+	} else if e.IsException() {
+		return e, nil
+	}
+	return core.NewString(port.AsPort().Contents()), nil
+}
+
+func specialFormWithInStr(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) < 1 {
+		return nil, errors.New("Error: Invalid syntax for `with-in-str`.")
+	}
+
+	if e, err := eval(&rest[0], environment); err != nil {
+		return nil, err
+	} else if e.IsException() {
+		return e, nil
+	} else if !e.IsString() {
+		return nil, errors.New("Error: `with-in-str` requires a string.")
+	} else {
+		return withBindings(eval, []string{"*in*"}, []core.Type{*core.NewStringInputPort(e.AsString())}, rest[1:], environment)
+	}
+}
+
+// specialFormWithEnv evaluates its body with the variables of a map added to
+// `*env*`, e.g. `(with-env {"LANG" "C"} (sh "date"))`.
+func specialFormWithEnv(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) < 1 {
+		return nil, errors.New("Error: Invalid syntax for `with-env`.")
+	}
+
+	if e, err := eval(&rest[0], environment); err != nil {
+		return nil, err
+	} else if e.IsException() {
+		return e, nil
+	} else if !e.IsHashmap() {
+		return nil, errors.New("Error: `with-env` requires a map.")
+	} else {
+		env := *core.NewHashmap()
+		current := environment.Get("*env*")
+		for key, value := range current.AsHashmap() {
+			env.HashmapSet(key, value)
+		}
+		for key, value := range e.AsHashmap() {
+			env.HashmapSet(core.NewHashmapKey(strings.TrimPrefix(key.Identifier, ":"), false), *core.NewString(value.ToString(false)))
+		}
+		return withBindings(eval, []string{"*env*"}, []core.Type{env}, rest[1:], environment)
+	}
+}
+
+// specialFormWithCwd evaluates its body with `*cwd*` set to a directory,
+// resolved against the current one.
+func specialFormWithCwd(eval func(*core.Type, *core.Environment) (*core.Type, error), rest []core.Type, environment *core.Environment) (*core.Type, error) {
+	if len(rest) < 1 {
+		return nil, errors.New("Error: Invalid syntax for `with-cwd`.")
+	}
+
+	if e, err := eval(&rest[0], environment); err != nil {
+		return nil, err
+	} else if e.IsException() {
+		return e, nil
+	} else if !e.IsString() {
+		return nil, errors.New("Error: `with-cwd` requires a string.")
+	} else if target, exception := changeDirectory(environment, e.AsString()); exception != nil {
+		return exception, nil
+	} else {
+		return withBindings(eval, []string{"*cwd*"}, []core.Type{*core.NewString(target)}, rest[1:], environment)
+	}
+}
+
+func bindingException(message string, symbol string) *core.Type {
+	return core.NewErrorException("binding-error", fmt.Sprintf(message, symbol), *core.NewSymbol(":var"), *core.NewSymbol(symbol))
+}
+
+// withBindings evaluates body with the dynamic variable each symbol names
+// bound to a value.
+func withBindings(eval func(*core.Type, *core.Environment) (*core.Type, error), symbols []string, values []core.Type, body []core.Type, environment *core.Environment) (*core.Type, error) {
+	vars := make([]*core.Var, len(symbols))
+	for i, symbol := range symbols {
+		// local bindings don't shadow the vars
+		root := environment.Root()
+		if root.Find(symbol) == nil {
+			return bindingException("Can't dynamically bind non-existent var '%s'.", symbol), nil
+		} else if vars[i] = root.Var(symbol); vars[i] == nil {
+			return bindingException("Can't dynamically bind non-dynamic var '%s'.", symbol), nil
+		}
+	}
+
+	if len(body) == 0 {
+		return core.NewNil(), nil
+	}
+	bound := environment.WithBindings(environment.Bindings().Bind(vars, values))
+	return eval(core.NewList(append([]core.Type{*core.NewSymbol("do")}, body...)...), bound)
+}
+
+func evalCallable(node *core.Type, bindings *core.Bindings) (*core.Type, error) {
 	first, rest := node.AsIterable()[0], node.AsIterable()[1:]
 
 	if first.IsCallable() {
-		result := first.CallCallable(rest...)
+		result := first.CallCallable(bindings, rest...)
 		return &result, nil
 	} else if first.IsException() {
 		return &first, nil
@@ -337,14 +603,80 @@ func evalAst(node *core.Type, environment *core.Environment, eval func(*core.Typ
 	return node, nil
 }
 
+// quoter expands quasiquote templates. It replaces symbols ending with `#`
+// with symbols generated once per template, and may qualify symbols.
+type quoter struct {
+	gensyms map[string]string
+	// qualify returns the symbol a template's symbol stands for
+	qualify func(symbol string) string
+}
+
+func newQuoter(qualify func(symbol string) string) *quoter {
+	if qualify == nil {
+		qualify = func(symbol string) string { return symbol }
+	}
+	return &quoter{gensyms: make(map[string]string), qualify: qualify}
+}
+
 func quasiquote(node core.Type) core.Type {
+	return newQuoter(nil).quote(node)
+}
+
+// syntaxQuote is quasiquote qualifying the global symbols, so that local
+// bindings where it's spliced can't capture them.
+func syntaxQuote(node core.Type, environment *core.Environment) core.Type {
+	return newQuoter(func(symbol string) string {
+		if _, qualified := core.Unqualified(symbol); !qualified && environment.Find(core.Namespace+"/"+symbol) != nil {
+			return core.Namespace + "/" + symbol
+		}
+		return symbol
+	}).quote(node)
+}
+
+// isAutoGensym tells whether a template's symbol is replaced by a generated
+// one, e.g. `x#`.
+func isAutoGensym(node core.Type) bool {
+	symbol := node.AsSymbol()
+	return node.IsSymbol() && strings.HasSuffix(symbol, "#") && len(symbol) > 1 && !node.IsKeyword()
+}
+
+// hasAutoGensyms tells whether a template generates symbols, which it does
+// anew every time it's expanded.
+func hasAutoGensyms(node core.Type) bool {
+	if isAutoGensym(node) {
+		return true
+	}
+	for _, element := range node.AsIterable() {
+		if hasAutoGensyms(element) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *quoter) symbol(node core.Type) core.Type {
+	symbol := node.AsSymbol()
+	if isAutoGensym(node) {
+		if _, ok := q.gensyms[symbol]; !ok {
+			q.gensyms[symbol] = gensym(strings.TrimSuffix(symbol, "#")+"__") + "__auto__"
+		}
+		return *core.NewSymbol(q.gensyms[symbol])
+	} else if node.IsKeyword() || symbol == "&" {
+		return node
+	}
+	return *core.NewSymbol(q.qualify(symbol))
+}
+
+func (q *quoter) quote(node core.Type) core.Type {
 	iterable := node.AsIterable()
 	unquoted := len(iterable) >= 2 && iterable[0].CompareSymbol("unquote")
 
-	if node.IsSymbol() || node.IsHashmap() || (node.IsVector() && unquoted) {
+	if node.IsSymbol() {
+		return *core.NewList(*core.NewSymbol("quote"), q.symbol(node))
+	} else if node.IsHashmap() || (node.IsVector() && unquoted) {
 		return *core.NewList(*core.NewSymbol("quote"), node)
 	} else if node.IsVector() {
-		return *core.NewList(*core.NewSymbol("vec"), quasiquote(*core.NewList(iterable...)))
+		return *core.NewList(*core.NewSymbol(q.qualify("vec")), q.quote(*core.NewList(iterable...)))
 	} else if unquoted {
 		return iterable[1]
 	} else if len(iterable) >= 1 {
@@ -354,9 +686,9 @@ func quasiquote(node core.Type) core.Type {
 			el := iterable[i]
 			eli := el.AsIterable()
 			if len(eli) >= 2 && eli[0].CompareSymbol("splice-unquote") {
-				result = *core.NewList(*core.NewSymbol("concat"), eli[1], result)
+				result = *core.NewList(*core.NewSymbol(q.qualify("concat")), eli[1], result)
 			} else {
-				result = *core.NewList(*core.NewSymbol("cons"), quasiquote(el), result)
+				result = *core.NewList(*core.NewSymbol(q.qualify("cons")), q.quote(el), result)
 			}
 		}
 
@@ -366,7 +698,7 @@ func quasiquote(node core.Type) core.Type {
 	return node
 }
 
-func isMacroCall(node core.Type, environment core.Environment, capture func(core.Type)) bool {
+func isMacroCall(node core.Type, environment *core.Environment, capture func(core.Type)) bool {
 	if iterable := node.AsIterable(); node.IsList() && len(iterable) >= 1 {
 		if first := iterable[0]; first.IsSymbol() {
 			if macro := environment.Get(first.AsSymbol()); macro.IsMacroFunction() {
@@ -378,16 +710,85 @@ func isMacroCall(node core.Type, environment core.Environment, capture func(core
 	return false
 }
 
-func macroexpand(node core.Type, environment core.Environment) core.Type {
+// macroexpand1 expands node once if it's a macro call, and tells whether it
+// was.
+func macroexpand1(node core.Type, environment *core.Environment) (core.Type, bool) {
 	var macro core.Type
 	capture := func(m core.Type) {
 		macro = m
 	}
 
-	for isMacroCall(node, environment, capture) {
-		parameters := node.AsIterable()[1:]
-		node = macro.CallFunction(parameters...)
+	if !isMacroCall(node, environment, capture) {
+		return node, false
+	}
+	parameters := node.AsIterable()[1:]
+	expansion := macro.CallFunction(environment.Bindings(), parameters...)
+	// the expansion stands for the form, e.g. for `def!` recording its source
+	if expansion.Source == nil {
+		expansion.Source = node.Source
+	}
+	return expansion, true
+}
+
+func macroexpand(node core.Type, environment *core.Environment) core.Type {
+	for expanded := true; expanded; {
+		node, expanded = macroexpand1(node, environment)
+	}
+	return node
+}
+
+// macroexpandAll expands node and every form it contains, except quoted ones.
+// Only the unquoted parts of quasiquote templates are expanded.
+func macroexpandAll(node core.Type, environment *core.Environment) core.Type {
+	node = macroexpand(node, environment)
+	if node.IsException() {
+		return node
+	}
+
+	iterable := node.AsIterable()
+	if node.IsList() && len(iterable) >= 1 {
+		if iterable[0].CompareSymbol("quote") {
+			return node
+		} else if iterable[0].CompareSymbol("quasiquote", "syntax-quote") {
+			return expandedForms(node, func(form core.Type) core.Type {
+				return macroexpandTemplate(form, environment)
+			}, 1)
+		}
+	}
+	return expandedForms(node, func(form core.Type) core.Type {
+		return macroexpandAll(form, environment)
+	}, 0)
+}
+
+// macroexpandTemplate expands the forms unquoted in a quasiquote template.
+func macroexpandTemplate(node core.Type, environment *core.Environment) core.Type {
+	if iterable := node.AsIterable(); node.IsList() && len(iterable) == 2 && iterable[0].CompareSymbol("unquote", "splice-unquote") {
+		return *core.NewList(iterable[0], macroexpandAll(iterable[1], environment))
 	}
+	return expandedForms(node, func(form core.Type) core.Type {
+		return macroexpandTemplate(form, environment)
+	}, 0)
+}
 
+// expandedForms applies expand to the elements of a list or a vector from
+// start on, or to the values of a hashmap. Other forms are returned as is.
+func expandedForms(node core.Type, expand func(core.Type) core.Type, start int) core.Type {
+	if node.IsIterable() {
+		newIterable := node.DeriveIterable()
+		for i, element := range node.AsIterable() {
+			if i >= start {
+				element = expand(element)
+			}
+			newIterable.Append(element)
+		}
+		newIterable.Source = node.Source
+		return *newIterable
+	} else if node.IsHashmap() {
+		newHashmap := core.NewHashmap()
+		for key, value := range node.AsHashmap() {
+			newHashmap.HashmapSet(key, expand(value))
+		}
+		return *newHashmap
+	}
 	return node
 }
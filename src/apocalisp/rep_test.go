@@ -1,17 +1,28 @@
 package apocalisp
 
 import (
+	"apocalisp/core"
 	"apocalisp/parser"
 	"testing"
 )
 
+var evaluators = map[string]func(*core.Type, *core.Environment) (*core.Type, error){"interpret": Interpret, "evaluate": Evaluate}
+
+// Repl_Test checks the output of in with both evaluators, so that every test
+// checks they agree.
 func Repl_Test(in string, eout string, t *testing.T) {
-	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	for name, eval := range evaluators {
+		Evaluator_Test(name, eval, in, eout, t)
+	}
+}
+
+func Evaluator_Test(name string, eval func(*core.Type, *core.Environment) (*core.Type, error), in string, eout string, t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, eval)
 
-	if out, err := Rep(in, environment, Evaluate, parser.Parser{}); err != nil && err.Error() != eout {
-		t.Errorf("(output) `%s` != `%s` (expected)", err.Error(), eout)
-	} else if out != eout {
-		t.Errorf("(output) `%s` != `%s` (expected)", out, eout)
+	if out, err := Rep(in, environment, eval, parser.Parser{}); err != nil && err.Error() != eout {
+		t.Errorf("%s: (output) `%s` != `%s` (expected)", name, err.Error(), eout)
+	} else if err == nil && out != eout {
+		t.Errorf("%s: (output) `%s` != `%s` (expected)", name, out, eout)
 	}
 }
 
@@ -81,3 +92,60 @@ func Test_Hashmap_Get(t *testing.T) {
 	Repl_Test(`(get {":key" "fvalue" :key "svalue"} ":key")`, `"fvalue"`, t)
 	Repl_Test(`(get {":key" "fvalue" :key "svalue"} :key)`, `"svalue"`, t)
 }
+
+func Test_Hygienic_Macros(t *testing.T) {
+	Repl_Test(`(symbol? (gensym))`, `true`, t)
+	Repl_Test(`(= (gensym "x") (gensym "x"))`, `false`, t)
+	Repl_Test(`(let* [form (quasiquote (x# x# y#))] (list (= (nth form 0) (nth form 1)) (= (nth form 0) (nth form 2))))`, `(true false)`, t)
+	Repl_Test(`(= (quasiquote x#) (quasiquote x#))`, `false`, t)
+	Repl_Test(`(quasiquote (list :k# &))`, `(list :k# &)`, t)
+	Repl_Test(`(syntax-quote (list ~(+ 1 2) undefined))`, `(user/list 3 undefined)`, t)
+	Repl_Test(`(do (defmacro! pair (fn* (a b) (syntax-quote (list ~a ~b)))) (let* [list (fn* (& xs) :captured)] (pair 1 2)))`, `(1 2)`, t)
+	Repl_Test(`(do (defmacro! swap-or (fn* (a b) (quasiquote (let* [v# ~a] (or ~b v#))))) (let* [v 1] (swap-or nil v)))`, `1`, t)
+	Repl_Test(`(let* [or# 5] (or nil or#))`, `5`, t)
+	Repl_Test(`(let* [value 3] (case value 3 value))`, `3`, t)
+}
+
+func Test_Macroexpand(t *testing.T) {
+	Repl_Test(`(macroexpand-1 (when-not x 1))`, `(if x nil (do 1))`, t)
+	Repl_Test(`(macroexpand-1 (when-let [x 1] x))`, `(user/if-let [x 1] (do x))`, t)
+	Repl_Test(`(macroexpand-1 (+ 1 2))`, `(+ 1 2)`, t)
+	Repl_Test(`(macroexpand-all (when a (quote (when b)) [(when c 1)] {:k (when d 2)}))`, `(if a (do (quote (when b)) [(if c (do 1))] {:k (if d (do 2))}))`, t)
+	Repl_Test(`(macroexpand-all (quasiquote (when a ~(when b 1))))`, `(quasiquote (when a (unquote (if b (do 1)))))`, t)
+}
+
+func Test_Dynamic_Variables(t *testing.T) {
+	Repl_Test(`(do (def-dynamic! *x* 1) [(binding [*x* 2] *x*) *x*])`, `[2 1]`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (def! f (fn* () *x*)) [(binding [*x* 2] (f)) (f)])`, `[2 1]`, t)
+	Repl_Test(`(do (def-dynamic! *x* "doc" 1) (def-dynamic! *x* 2) [*x* (get (meta (var *x*)) :dynamic)])`, `[2 true]`, t)
+	Repl_Test(`(do ((fn* () (def-dynamic! *x* 1))) *x*)`, `1`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (def! *x* 2) (binding [*x* 3] nil) *x*)`, `2`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) [(binding [*x* 2] (do (def! *x* 10) *x*)) *x*])`, `[2 10]`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) [(let* [*x* 4] (binding [*x* 5] *x*)) (let* [*x* 4] (binding [*x* 5] user/*x*))])`, `[4 5]`, t)
+	Repl_Test(`(do (def! y 1) (try* (binding [y 2] @(future y)) (catch* e [(get e :type) (get e :message) (get e :var)])))`, `[:binding-error "Can't dynamically bind non-dynamic var 'y'." y]`, t)
+	Repl_Test(`(try* (binding [undefined-var 2] nil) (catch* e (get e :message)))`, `"Can't dynamically bind non-existent var 'undefined-var'."`, t)
+	Syntax_Error_Test(`(def-dynamic! *x*)`, "Error: Invalid syntax for `def-dynamic!`.", t)
+}
+
+func Test_Dynamic_Bindings_Are_Per_Goroutine(t *testing.T) {
+	Repl_Test(`(do (def-dynamic! *x* 1) (let* [p (promise) f (future (do @p *x*))] (binding [*x* 2] (do (deliver p true) [*x* @f]))))`, `[2 1]`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (binding [*x* 2] [@(future *x*) (<! (go *x*))]))`, `[2 2]`, t)
+	Repl_Test(`(let* [a (future (with-out-str (dotimes [i 100] (println "a")))) b (future (with-out-str (dotimes [i 100] (println "b"))))] [(count (filter (fn* (c) (= c "b")) (seq @a))) (count (seq @b))])`, `[0 200]`, t)
+}
+
+func Test_Dynamic_Bindings_Follow_Calls(t *testing.T) {
+	Repl_Test(`(do (def-dynamic! *x* 1) (def! f (fn* (_) *x*)) (binding [*x* 2] [(map f [0]) (apply f [0]) (eval '*x*)]))`, `[(2) 2 2]`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (binding [*x* 2] (let* [a (atom 0)] (do (swap! a (fn* (_) *x*)) @a))))`, `2`, t)
+	Repl_Test(`(do (def! f (fn* () (println "f"))) (with-out-str (map (fn* (_) (f)) [1 2])))`, `"f\nf\n"`, t)
+	Repl_Test(`(with-out-str (let* [*out* 5] (println 1)))`, `"1\n"`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (binding [*x* 2] (def! defined-in-binding *x*)) defined-in-binding)`, `2`, t)
+}
+
+func Test_Set_Dynamic_Variables(t *testing.T) {
+	Repl_Test(`(do (def-dynamic! *x* 1) [(binding [*x* 2] (do (set! *x* 3) *x*)) *x*])`, `[3 1]`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (binding [*x* 2] (binding [*x* 3] (set! *x* 4)) *x*))`, `2`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (binding [*x* 2] (try* (set! *x* (throw "no")) (catch* e *x*))))`, `2`, t)
+	Repl_Test(`(do (def-dynamic! *x* 1) (try* (set! *x* 2) (catch* e [(get e :type) (get e :message)])))`, "[:binding-error \"Can't set! '*x*' outside of a `binding`.\"]", t)
+	Repl_Test(`(do (def! x 1) (try* (set! x 3) (catch* e (get e :message))))`, `"Can't set! 'x', which isn't a dynamic variable."`, t)
+	Syntax_Error_Test(`(set! 1 2)`, "Error: Invalid syntax for `set!`.", t)
+}
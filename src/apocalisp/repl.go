@@ -2,14 +2,85 @@ package apocalisp
 
 import (
 	"apocalisp/core"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/peterh/liner"
 )
 
+const usage = `usage: apocalisp [-e EXPR]... [-i] [--no-rc] [--profile] [SCRIPT | -] [ARG]...
+
+Interactive sessions on a terminal start in shell mode: lines not starting
+with ( are run as command lines, e.g. ls -la | grep foo > out.txt, where a
+$ before a form, e.g. $(+ 1 2), expands to its value. && and || chain commands,
+& runs them in the background, and jobs, fg, bg and kill control them. The
+exit status of the last command is kept in *exit*.
+
+Lines starting with ( are read as Lisp, and so is every line of sessions
+reading from a pipe. Evaluate (def! *shell-mode* false), e.g. in
+~/.apocalisprc, to read Lisp only.`
+
+// replOptions holds the command-line flags. Script is "-" when it's read from
+// stdin.
+type replOptions struct {
+	expressions []string
+	script      string
+	arguments   []string
+	interactive bool
+	rc          bool
+	// report the time and memory each evaluation takes
+	profile bool
+}
+
+func parseReplArguments(args []string) (replOptions, error) {
+	options := replOptions{rc: true}
+	forceInteractive := false
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-e":
+			if i+1 >= len(args) {
+				return options, errors.New("Error: missing expression after '-e'.")
+			}
+			i++
+			options.expressions = append(options.expressions, args[i])
+		case arg == "-i":
+			forceInteractive = true
+		case arg == "--no-rc":
+			options.rc = false
+		case arg == "--profile":
+			options.profile = true
+		case arg == "--":
+			if i+1 < len(args) {
+				options.script, options.arguments = args[i+1], args[i+2:]
+			}
+			i = len(args)
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			options.script, options.arguments = arg, args[i+1:]
+			i = len(args)
+		default:
+			return options, errors.New(fmt.Sprintf("Error: unknown option '%s'.", arg))
+		}
+	}
+
+	options.interactive = forceInteractive || (options.script == "" && len(options.expressions) == 0)
+	return options, nil
+}
+
+// isTerminal tells whether file is a terminal, rather than e.g. a pipe.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func withLiner(handler func(*liner.State)) {
 	state := liner.NewLiner()
 	defer state.Close()
@@ -18,68 +89,265 @@ func withLiner(handler func(*liner.State)) {
 	handler(state)
 }
 
+// stateDirectory is where the REPL keeps its history, following the XDG base
+// directory specification.
+func stateDirectory(environment *core.Environment) string {
+	if state, ok := getenv(environment, "XDG_STATE_HOME"); ok && filepath.IsAbs(state) {
+		return filepath.Join(state, "apocalisp")
+	} else if home, ok := getenv(environment, "HOME"); ok {
+		return filepath.Join(home, ".local", "state", "apocalisp")
+	}
+	return ""
+}
+
+// prompt calls `*prompt*`, falling back to the default prompt if it fails.
+func prompt(environment *core.Environment) string {
+	if environment.Find("*prompt*") == nil {
+		return "user> "
+	}
+
+	result := environment.Get("*prompt*")
+	if result.IsFunction() {
+		result = result.CallFunction(environment.Bindings())
+	} else if result.IsCallable() {
+		result = result.CallCallable(environment.Bindings())
+	}
+
+	if result.IsException() {
+		writeLine(environment, "*err*", "Error in *prompt*: "+result.ToString(false))
+		return "user> "
+	}
+	return result.ToString(false)
+}
+
+// runSource evaluates every form of source in order, like `load-file`.
+func runSource(source string, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) error {
+	_, err := Rep(fmt.Sprintf("(do %s\nnil)", source), environment, eval, parser)
+	return err
+}
+
 func Repl(eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) {
 	// decrease max stack size to make TCO-related tests useful
 	debug.SetMaxStack(1 * 1024 * 1024)
 
-	cwd, err := os.Getwd()
+	options, err := parseReplArguments(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// environment
+	environment := DefaultEnvironment(parser, eval)
+
+	argv := core.NewList()
+	for i := range options.arguments {
+		argv.Append(core.Type{String: &options.arguments[i]})
+	}
+	environment.Set("*ARGV*", *argv)
+	environment.Set("*host-language*", *core.NewString("apocalisp"))
+	// when enabled, lines not starting with `(` are run as command lines
+	environment.Set("*shell-mode*", *core.NewBoolean(options.interactive && isTerminal(os.Stdin)))
+	environment.Set("*exit*", *core.NewNumber(0))
+	environment.Set("*banner*", *core.NewString("Mal [apocalisp]"))
+	for _, symbol := range []string{"*1", "*2", "*3", "*e"} {
+		environment.Set(symbol, *core.NewNil())
+	}
+
+	_, _ = Rep(`(def! *prompt* (fn* () "user> "))`, environment, eval, parser)
+
+	if options.profile {
+		eval = profiled(eval, os.Stderr)
+	}
+
+	if options.interactive && options.rc {
+		if home, ok := getenv(environment, "HOME"); ok {
+			if contents, err := os.ReadFile(filepath.Join(home, ".apocalisprc")); err == nil {
+				if err := runSource(string(contents), environment, eval, parser); err != nil {
+					fmt.Fprintf(os.Stderr, "Error in ~/.apocalisprc: %s\n", err.Error())
+				}
+			}
+		}
+	}
+
+	for _, expression := range options.expressions {
+		if output, err := Rep(expression, environment, eval, parser); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		} else if len(output) > 0 && output != "nil" {
+			fmt.Println(output)
+		}
+	}
+
+	if options.script == "-" {
+		if contents, err := io.ReadAll(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		} else if err := runSource(string(contents), environment, eval, parser); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	} else if options.script != "" {
+		if _, err := Rep(fmt.Sprintf(`(load-file "%s")`, options.script), environment, eval, parser); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+
+	if options.interactive {
+		interact(environment, eval, parser)
+	}
+}
+
+// readEval reads and evaluates sexpr like Rep, but returns the value itself,
+// which is nil for empty input.
+func readEval(sexpr string, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) (*core.Type, error) {
+	if t, err := parser.Parse(sexpr); err != nil || t == nil {
+		return nil, err
+	} else {
+		return eval(t, environment)
+	}
+}
+
+// rememberValue keeps the last three results in `*1`, `*2` and `*3`.
+func rememberValue(environment *core.Environment, value core.Type) {
+	environment.Set("*3", environment.Get("*2"))
+	environment.Set("*2", environment.Get("*1"))
+	environment.Set("*1", value)
+}
+
+// rememberException keeps the last exception in `*e`.
+func rememberException(environment *core.Environment, exception core.Type) {
+	environment.Set("*e", exception)
+}
+
+// incompleteParser is implemented by parsers able to tell unfinished input
+// apart from invalid input.
+type incompleteParser interface {
+	Incomplete(sexpr string) bool
+}
+
+// readInput prompts until the input holds complete forms, and adds it to the
+// history as one entry.
+func readInput(line *liner.State, environment *core.Environment, parser core.Parser) (string, error) {
+	p := prompt(environment)
+	input, err := line.Prompt(p)
 	if err != nil {
-		fmt.Print("Error while calling 'os.Getwd()'.")
-		os.Exit(1)
+		return "", err
+	}
+
+	lines := []string{input}
+	continuation := fmt.Sprintf("%*s", utf8.RuneCountInString(p), "... ")
+	if incomplete, ok := parser.(incompleteParser); ok && !IsShellLine(input, environment) {
+		for incomplete.Incomplete(strings.Join(lines, "\n")) {
+			if input, err = line.Prompt(continuation); err == io.EOF {
+				// let the parser report the unfinished form
+				break
+			} else if err != nil {
+				return "", err
+			}
+			lines = append(lines, input)
+		}
+	}
+
+	line.AppendHistory(historyEntry(lines))
+	return strings.Join(lines, "\n"), nil
+}
+
+// historyEntry joins the lines of an input into a single line, without their
+// comments, which would otherwise comment out the lines following them.
+func historyEntry(lines []string) string {
+	code, inString := make([]string, 0, len(lines)), false
+	for _, line := range lines {
+		escaped := false
+		for i, r := range line {
+			if escaped {
+				escaped = false
+			} else if r == '\\' && inString {
+				escaped = true
+			} else if r == '"' {
+				inString = !inString
+			} else if r == ';' && !inString {
+				line = strings.TrimRightFunc(line[:i], unicode.IsSpace)
+				break
+			}
+		}
+		if line != "" {
+			code = append(code, line)
+		}
 	}
-	historyFilePath := filepath.Join(cwd, ".apocalisp_history")
+	return strings.Join(code, " ")
+}
 
+func interact(environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) {
 	line := liner.NewLiner()
 	defer line.Close()
 	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(func(l string, pos int) (string, []string, string) {
+		return complete(l, pos, environment)
+	})
 
 	// read/write history
-	if f, err := os.Open(historyFilePath); err == nil {
-		line.ReadHistory(f)
-		f.Close()
-	}
-	defer func() {
-		if f, err := os.Create(historyFilePath); err == nil {
-			line.WriteHistory(f)
+	if directory := stateDirectory(environment); directory != "" {
+		historyFilePath := filepath.Join(directory, "history")
+		if f, err := os.Open(historyFilePath); err == nil {
+			line.ReadHistory(f)
 			f.Close()
 		}
-	}()
+		defer func() {
+			if err := os.MkdirAll(directory, 0700); err != nil {
+				return
+			}
+			if f, err := os.Create(historyFilePath); err == nil {
+				line.WriteHistory(f)
+				f.Close()
+			}
+		}()
+	}
 
-	// environment
-	environment := DefaultEnvironment(parser, eval)
+	if banner := environment.Get("*banner*"); banner.IsString() && banner.AsString() != "" {
+		fmt.Println(banner.AsString())
+	}
+	enableJobControl()
 
-	argv := core.NewList()
-	for i := range os.Args {
-		if i > 1 {
-			argv.Append(core.Type{String: &os.Args[i]})
+	// Ctrl-C interrupts the evaluation instead of killing the REPL. Prompting
+	// isn't affected: liner reads it as a key.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer func() {
+		signal.Stop(interrupts)
+		close(interrupts)
+	}()
+	go func() {
+		for range interrupts {
+			Interrupt()
 		}
-	}
-	environment.Set("*ARGV*", *argv)
-	environment.Set("*host-language*", *core.NewString("apocalisp"))
+	}()
 
-	_, _ = Rep(`(def! not (fn* (a) (if a false true)))`, environment, eval, parser)
-	_, _ = Rep(`(def! load-file (fn* (f) (eval (read-string (str "(do " (slurp f) "\nnil)")))))`, environment, eval, parser)
-	_, _ = Rep(`(defmacro! cond (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw "odd number of forms to cond")) (cons 'cond (rest (rest xs)))))))`, environment, eval, parser)
+	for {
+		// the last evaluation is over, interrupted or not
+		clearInterrupt()
+		jobs.notify(os.Stderr)
 
-	if len(os.Args) >= 2 {
-		_, _ = Rep(fmt.Sprintf(`(load-file "%s")`, os.Args[1]), environment, eval, parser)
-	} else {
-		_, _ = Rep(`(println (str "Mal [" *host-language* "]"))`, environment, eval, parser)
-		for {
-			if sexpr, err := line.Prompt("user> "); err == nil {
-				line.AppendHistory(sexpr)
-
-				if output, err := Rep(sexpr, environment, eval, parser); err == nil {
-					if len(output) > 0 {
-						fmt.Println(output)
-					}
-				} else {
+		if sexpr, err := readInput(line, environment, parser); err == liner.ErrPromptAborted {
+			// Ctrl-C discards the current input instead of leaving the shell
+			continue
+		} else if err == nil {
+			if IsShellLine(sexpr, environment) {
+				if err := RepShell(sexpr, environment, eval, parser); err != nil {
 					fmt.Println(err.Error())
 				}
-			} else {
-				fmt.Println("\nFarewell!")
-				break
+			} else if value, err := readEval(sexpr, environment, eval, parser); err != nil {
+				rememberException(environment, *core.NewString(err.Error()))
+				fmt.Println(err.Error())
+			} else if value != nil && value.IsException() {
+				rememberException(environment, *value.AsException())
+				fmt.Println(value.ToString(false))
+			} else if value != nil {
+				rememberValue(environment, *value)
+				if output := value.ToString(true); len(output) > 0 {
+					fmt.Println(output)
+				}
 			}
+		} else {
+			fmt.Println("\nFarewell!")
+			break
 		}
 	}
 }
@@ -0,0 +1,101 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Parse_Repl_Arguments(t *testing.T) {
+	mapping := map[string]struct {
+		args     []string
+		expected replOptions
+	}{
+		"none":    {[]string{}, replOptions{interactive: true, rc: true}},
+		"script":  {[]string{"a.mal", "-e", "x"}, replOptions{script: "a.mal", arguments: []string{"-e", "x"}, rc: true}},
+		"stdin":   {[]string{"--no-rc", "-", "x"}, replOptions{script: "-", arguments: []string{"x"}}},
+		"eval":    {[]string{"-e", "(+ 1 2)", "-e", "3"}, replOptions{expressions: []string{"(+ 1 2)", "3"}, rc: true}},
+		"profile": {[]string{"--profile", "-e", "1"}, replOptions{expressions: []string{"1"}, rc: true, profile: true}},
+		"-i":      {[]string{"-i", "-e", "1", "--", "-a.mal"}, replOptions{expressions: []string{"1"}, script: "-a.mal", arguments: []string{}, interactive: true, rc: true}},
+	}
+
+	for name, test := range mapping {
+		if options, err := parseReplArguments(test.args); err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		} else if !reflect.DeepEqual(options, test.expected) {
+			t.Errorf("%s: %#v != %#v (expected)", name, options, test.expected)
+		}
+	}
+
+	if _, err := parseReplArguments([]string{"-e"}); err == nil || err.Error() != "Error: missing expression after '-e'." {
+		t.Errorf("A missing expression should fail, got %v", err)
+	}
+	if _, err := parseReplArguments([]string{"--frobnicate"}); err == nil || err.Error() != "Error: unknown option '--frobnicate'." {
+		t.Errorf("Unknown options should fail, got %v", err)
+	}
+}
+
+func Test_Prompt(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	environment.Set("*exit*", *core.NewNumber(3))
+	report := core.NewStringOutputPort()
+	environment.Set("*err*", *report)
+
+	for input, expected := range map[string]string{
+		`(def! *prompt* (fn* () (str *exit* "> ")))`: "3> ",
+		`(def! *prompt* "$ ")`:                       "$ ",
+		`(def! *prompt* (fn* () (throw "oops")))`:    "user> ",
+	} {
+		Rep(input, environment, Evaluate, parser.Parser{})
+		if output := prompt(environment); output != expected {
+			t.Errorf("(output) `%s` != `%s` (expected)", output, expected)
+		}
+	}
+	if output := report.AsPort().Contents(); output != "Error in *prompt*: Exception: \"oops\"\n" {
+		t.Errorf("The failing prompt should have been reported, got `%s`.", output)
+	}
+}
+
+func Test_History_Entries_Drop_Comments(t *testing.T) {
+	for expected, lines := range map[string][]string{
+		`(+ 1 2)`:                   {`(+ 1 2)`},
+		`(do 1 2)`:                  {`(do 1 ; one`, `;; two`, `2)`},
+		`(str "a;b" "\";") (prn 1)`: {`(str "a;b" "\";") ; str`, `(prn 1)`},
+		`(str "multi ;line" "x")`:   {`(str "multi`, `;line" "x") ;end`},
+	} {
+		if output := historyEntry(lines); output != expected {
+			t.Errorf("(output) `%s` != `%s` (expected)", output, expected)
+		}
+	}
+}
+
+func Test_State_Directory(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	Rep(`(do (setenv "HOME" "/home/user") (unsetenv "XDG_STATE_HOME"))`, environment, Evaluate, parser.Parser{})
+	if directory := stateDirectory(environment); directory != filepath.Join("/home/user", ".local", "state", "apocalisp") {
+		t.Errorf("Unexpected state directory `%s`.", directory)
+	}
+
+	Rep(`(setenv "XDG_STATE_HOME" "/state")`, environment, Evaluate, parser.Parser{})
+	if directory := stateDirectory(environment); directory != filepath.Join("/state", "apocalisp") {
+		t.Errorf("Unexpected state directory `%s`.", directory)
+	}
+}
+
+func Test_Is_Terminal(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// sessions reading from a pipe don't start in shell mode
+	if isTerminal(reader) {
+		t.Error("A pipe isn't a terminal.")
+	}
+}
@@ -0,0 +1,135 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits bound what a Sandbox evaluation may use. Zero values don't limit
+// anything.
+type Limits struct {
+	// Steps is how many forms may be evaluated.
+	Steps int64
+	// Depth is how deeply evaluations may nest, e.g. with recursive calls.
+	Depth int64
+	// CollectionSize is how many elements the lists, vectors, maps and
+	// strings created may hold.
+	CollectionSize int
+	// Catchable throws a catchable exception instead of failing. Steps and the
+	// context stay exhausted, so the handler can't go on.
+	Catchable bool
+}
+
+// limiter enforces Limits, and the context given to the evaluation.
+type limiter struct {
+	Limits
+	context context.Context
+	steps   int64
+	depth   int64
+	// set once the context is done, which is checked every contextInterval
+	// steps
+	interrupted int32
+}
+
+// contextInterval is how many steps are evaluated between checks of the
+// context.
+const contextInterval = 64
+
+func (l *limiter) reset(ctx context.Context) {
+	l.context = ctx
+	atomic.StoreInt64(&l.steps, 0)
+	atomic.StoreInt64(&l.depth, 0)
+	atomic.StoreInt32(&l.interrupted, 0)
+}
+
+// exceeded reports a limit being exceeded, as an exception or an error
+// depending on Catchable.
+func (l *limiter) exceeded(limit string, message string) (*core.Type, error) {
+	if l.Catchable {
+		return core.NewErrorException("limit-error", message, *core.NewSymbol(":limit"), *core.NewSymbol(":" + limit)), nil
+	}
+	return nil, errors.New(fmt.Sprintf("Error: %s", message))
+}
+
+func (l *limiter) step() (*core.Type, error) {
+	steps := atomic.AddInt64(&l.steps, 1)
+	if l.Steps > 0 && steps > l.Steps {
+		return l.exceeded("steps", fmt.Sprintf("Evaluation exceeded %d steps.", l.Steps))
+	}
+	if steps%contextInterval == 0 && l.context != nil && l.context.Err() != nil {
+		atomic.StoreInt32(&l.interrupted, 1)
+	}
+	if atomic.LoadInt32(&l.interrupted) == 1 {
+		return l.exceeded("context", fmt.Sprintf("Evaluation interrupted: %s.", l.context.Err().Error()))
+	}
+	return nil, nil
+}
+
+// enter is called when an evaluation starts, and leave when it ends.
+func (l *limiter) enter() (*core.Type, error) {
+	if depth := atomic.AddInt64(&l.depth, 1); l.Depth > 0 && depth > l.Depth {
+		atomic.AddInt64(&l.depth, -1)
+		return l.exceeded("depth", fmt.Sprintf("Evaluation exceeded a depth of %d.", l.Depth))
+	}
+	return nil, nil
+}
+
+func (l *limiter) leave() {
+	atomic.AddInt64(&l.depth, -1)
+}
+
+func (l *limiter) size(value *core.Type) (*core.Type, error) {
+	if l.CollectionSize <= 0 || value == nil {
+		return nil, nil
+	}
+
+	size := 0
+	if value.IsIterable() {
+		size = len(value.AsIterable())
+	} else if value.IsHashmap() {
+		size = len(value.AsHashmap())
+	} else if value.IsString() {
+		size = len(value.AsString())
+	}
+	if size > l.CollectionSize {
+		return l.exceeded("collection-size", fmt.Sprintf("Evaluation created a collection of %d elements, more than %d.", size, l.CollectionSize))
+	}
+	return nil, nil
+}
+
+// Sandbox evaluates untrusted code within Limits, in a RestrictedEnvironment.
+// It evaluates one form at a time.
+type Sandbox struct {
+	Environment *core.Environment
+	parser      core.Parser
+	compiler    *compiler
+}
+
+func NewSandbox(parser core.Parser, limits Limits) *Sandbox {
+	// the prelude is compiled by the sandbox's compiler, so that its functions
+	// and macros are limited too, but loaded before the limits are set
+	compiler := &compiler{limits: &limiter{}}
+	environment := RestrictedEnvironment(parser, compiler.evaluate)
+	compiler.limits.Limits = limits
+
+	return &Sandbox{
+		Environment: environment,
+		parser:      parser,
+		compiler:    compiler,
+	}
+}
+
+// Eval evaluates node until ctx is done.
+func (sandbox *Sandbox) Eval(ctx context.Context, node *core.Type) (*core.Type, error) {
+	sandbox.compiler.limits.reset(ctx)
+	return sandbox.compiler.evaluate(node, sandbox.Environment)
+}
+
+// Rep reads, evaluates and prints sexpr like Rep, until ctx is done.
+func (sandbox *Sandbox) Rep(ctx context.Context, sexpr string) (string, error) {
+	sandbox.compiler.limits.reset(ctx)
+	return Rep(sexpr, sandbox.Environment, sandbox.compiler.evaluate, sandbox.parser)
+}
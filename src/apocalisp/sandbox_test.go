@@ -0,0 +1,88 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Sandbox_Test(limits Limits, in string, expected string, t *testing.T) {
+	sandbox := NewSandbox(parser.Parser{}, limits)
+	if out, err := sandbox.Rep(context.Background(), in); err != nil && err.Error() != expected {
+		t.Errorf("(output) `%s` != `%s` (expected)", err.Error(), expected)
+	} else if err == nil && out != expected {
+		t.Errorf("(output) `%s` != `%s` (expected)", out, expected)
+	}
+}
+
+const loop = `(do (def! loop (fn* (n) (loop (+ n 1)))) (loop 0))`
+const recursion = `(do (def! deep (fn* (n) (let* [m (deep n)] (+ m 1)))) (deep 0))`
+
+func Test_Sandbox_Limits_Steps(t *testing.T) {
+	Sandbox_Test(Limits{Steps: 1000}, `(+ 1 2)`, `3`, t)
+	Sandbox_Test(Limits{Steps: 1000}, loop, `Error: Evaluation exceeded 1000 steps.`, t)
+	Sandbox_Test(Limits{Steps: 1000}, `(try* `+loop+` (catch* e :caught))`, `Error: Evaluation exceeded 1000 steps.`, t)
+
+	// the handler can't go on, so the exception is the result
+	catchable := NewSandbox(parser.Parser{}, Limits{Steps: 1000, Catchable: true})
+	node, _ := parser.Parser{}.Parse(`(try* ` + loop + ` (catch* e (get e :limit)))`)
+	if result, err := catchable.Eval(context.Background(), node); err != nil || !result.IsException() {
+		t.Errorf("Expected an exception, got %v, %v.", result, err)
+	} else if limit := result.AsException().AsHashmap()[core.NewHashmapKey(":limit", true)]; limit.ToString(true) != ":steps" {
+		t.Errorf("Unexpected exception %s.", result.ToString(true))
+	}
+
+	// so are the steps of the prelude's macros, here expanding the clauses
+	whens := strings.Repeat(" :when true", 300)
+	Sandbox_Test(Limits{}, `(for [x []`+whens+`] x)`, `()`, t)
+	Sandbox_Test(Limits{Steps: 1000}, `(for [x []`+whens+`] x)`, `Exception: "Error: Evaluation exceeded 1000 steps."`, t)
+
+	// the steps are counted again for every evaluation
+	sandbox := NewSandbox(parser.Parser{}, Limits{Steps: 100})
+	for i := 0; i < 3; i++ {
+		if out, err := sandbox.Rep(context.Background(), `(do (def! x 1) (+ x 1))`); err != nil || out != "2" {
+			t.Errorf("Unexpected result `%s`, %v.", out, err)
+		}
+	}
+}
+
+func Test_Sandbox_Limits_Depth(t *testing.T) {
+	Sandbox_Test(Limits{Depth: 200}, recursion, `Error: Evaluation exceeded a depth of 200.`, t)
+	Sandbox_Test(Limits{Depth: 200, Catchable: true}, `(try* `+recursion+` (catch* e (get e :limit)))`, `:depth`, t)
+	Sandbox_Test(Limits{Depth: 200}, `(do (def! sum (fn* (n acc) (if (= n 0) acc (sum (- n 1) (+ acc n))))) (sum 1000 0))`, `500500`, t)
+}
+
+func Test_Sandbox_Limits_Collection_Size(t *testing.T) {
+	Sandbox_Test(Limits{CollectionSize: 100}, `(count (concat [1 2] [3]))`, `3`, t)
+	Sandbox_Test(Limits{CollectionSize: 100}, `(do (def! grow (fn* (xs) (grow (concat xs xs)))) (grow [1]))`, `Error: Evaluation created a collection of 128 elements, more than 100.`, t)
+	Sandbox_Test(Limits{CollectionSize: 15, Catchable: true}, `(try* (let* [s (str "0123456789" "0123456789")] s) (catch* e (get e :limit)))`, `:collection-size`, t)
+}
+
+func Test_Sandbox_Limits_Time(t *testing.T) {
+	sandbox := NewSandbox(parser.Parser{}, Limits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := sandbox.Rep(ctx, loop); err == nil || err.Error() != "Error: Evaluation interrupted: context deadline exceeded." {
+		t.Errorf("The evaluation should have timed out, got %v.", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("The evaluation took %s to time out.", elapsed)
+	}
+
+	if out, err := sandbox.Rep(context.Background(), `(+ 1 2)`); err != nil || out != "3" {
+		t.Errorf("The sandbox should evaluate again, got `%s`, %v.", out, err)
+	}
+}
+
+func Test_Restricted_Environment(t *testing.T) {
+	for _, symbol := range []string{"slurp", "readline", "eval", "load-file", "open-input", "open-output", "spit", "sh", "ls", "getenv", "cd", "future-call", "promise", "chan", "timeout", "*stdin*", "*stdout*", "*stderr*"} {
+		Sandbox_Test(Limits{}, `(try* `+symbol+` (catch* e e))`, `"'`+symbol+`' not found"`, t)
+	}
+	Sandbox_Test(Limits{}, `(read-line)`, `nil`, t)
+	Sandbox_Test(Limits{}, `(with-out-str (println (when true (-> 1 (+ 2)))))`, `"3\n"`, t)
+}
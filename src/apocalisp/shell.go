@@ -0,0 +1,317 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/shell"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// IsShellLine tells whether the REPL should run line as a command line: shell
+// mode is on and the line isn't an s-expression.
+func IsShellLine(line string, environment *core.Environment) bool {
+	mode := environment.Get("*shell-mode*")
+	return mode.CompareBoolean(true) && !strings.HasPrefix(strings.TrimSpace(line), "(")
+}
+
+// RepShell runs a shell mode command line, e.g. `ls -la | grep foo > out.txt`,
+// and stores the exit status of its last pipeline in `*exit*`.
+func RepShell(line string, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) error {
+	chains, err := shell.Parse(line)
+	if err != nil {
+		return err
+	}
+
+	for _, chain := range chains {
+		status := 0
+		if chain.Background && len(chain.Pipelines) > 1 {
+			runBackgroundChain(chain, environment, eval, parser)
+		} else {
+			for i, pipeline := range chain.Pipelines {
+				if skipped(chain, i, status) {
+					continue
+				}
+				if status, err = runShellPipeline(pipeline, chain.Background, environment, eval, parser); err != nil {
+					return err
+				}
+			}
+		}
+		environment.Set("*exit*", *core.NewNumber(float64(status)))
+	}
+
+	return nil
+}
+
+// skipped tells whether `&&` or `||` skip the pipeline at index of chain.
+func skipped(chain shell.Chain, index int, status int) bool {
+	return index > 0 && ((chain.Operators[index-1] == "&&" && status != 0) || (chain.Operators[index-1] == "||" && status == 0))
+}
+
+// runBackgroundChain runs an and/or list ending in `&` as a single job, which
+// starts its pipelines one after the other once the previous one exits.
+func runBackgroundChain(chain shell.Chain, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) {
+	stderr := inheritedOutput(environment, "*err*", "*stderr*", os.Stderr)
+	j := jobs.add(&job{text: chainText(chain), chain: &jobChain{finished: make(chan struct{})}})
+	fmt.Fprintf(stderr, "[%d] %s &\n", j.id, j.text)
+
+	go func() {
+		status := 0
+		for i, pipeline := range chain.Pipelines {
+			if skipped(chain, i, status) {
+				continue
+			}
+
+			started, builtinStatus, err := startShellPipeline(pipeline, false, environment, eval, parser)
+			if err != nil {
+				fmt.Fprintf(stderr, "apocalisp: %s\n", err.Error())
+				status = 1
+			} else if started == nil {
+				status = builtinStatus
+			} else {
+				j.chain.mutex.Lock()
+				j.chain.pgid = started.pgid
+				j.chain.mutex.Unlock()
+				status = started.wait()
+				j.chain.mutex.Lock()
+				j.chain.pgid = 0
+				j.chain.mutex.Unlock()
+			}
+		}
+		j.chain.status = status
+		close(j.chain.finished)
+	}()
+}
+
+// chainText describes chain for `jobs`, with its words unexpanded.
+func chainText(chain shell.Chain) string {
+	parts := make([]string, 0)
+	for i, pipeline := range chain.Pipelines {
+		if i > 0 {
+			parts = append(parts, chain.Operators[i-1])
+		}
+		for j, command := range pipeline {
+			if j > 0 {
+				parts = append(parts, "|")
+			}
+			for _, word := range command.Words {
+				parts = append(parts, wordText(word))
+			}
+			for _, redirection := range command.Redirections {
+				parts = append(parts, redirection.Operator, wordText(redirection.Target))
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func wordText(word shell.Word) string {
+	text := ""
+	for _, segment := range word {
+		if segment.Lisp {
+			text += "$"
+		}
+		text += segment.Text
+	}
+	return text
+}
+
+// expandWord turns a word into arguments: a lone `$(...)` sequence splices,
+// globs expand to the matching paths and a leading `~` to `HOME`.
+func expandWord(word shell.Word, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) ([]string, error) {
+	var text, pattern strings.Builder
+	globbing := false
+
+	for i, segment := range word {
+		value := segment.Text
+		if i == 0 && !segment.Quoted && !segment.Lisp && (value == "~" || strings.HasPrefix(value, "~/")) {
+			if home, ok := getenv(environment, "HOME"); ok {
+				value = home + strings.TrimPrefix(value, "~")
+			}
+		}
+		if segment.Lisp {
+			node, err := parser.Parse(segment.Text)
+			if err != nil {
+				return nil, err
+			}
+
+			evaluated, err := eval(node, environment)
+			if err != nil {
+				return nil, err
+			} else if evaluated.IsException() {
+				return nil, errors.New(evaluated.ToString(false))
+			} else if len(word) == 1 && evaluated.IsIterable() {
+				arguments := make([]string, 0)
+				for _, element := range evaluated.AsIterable() {
+					arguments = append(arguments, element.ToString(false))
+				}
+				return arguments, nil
+			}
+			value = evaluated.ToString(false)
+		}
+
+		text.WriteString(value)
+		if segment.Quoted || segment.Lisp {
+			for _, r := range value {
+				if strings.ContainsRune(`*?[\`, r) {
+					pattern.WriteRune('\\')
+				}
+				pattern.WriteRune(r)
+			}
+		} else {
+			pattern.WriteString(value)
+			globbing = globbing || strings.ContainsAny(value, "*?[")
+		}
+	}
+
+	if globbing {
+		if matches, err := globPaths(environment, pattern.String()); err == nil && len(matches) > 0 {
+			return matches, nil
+		}
+	}
+	return []string{text.String()}, nil
+}
+
+// inheritedInput is what processes read when stdin isn't redirected: the
+// terminal, unless `*in*` is bound to another port.
+func inheritedInput(environment *core.Environment) io.Reader {
+	if in, stdin := environment.Get("*in*"), environment.Get("*stdin*"); !in.Compare(stdin) && in.IsPort() && in.AsPort().IsInput() {
+		return in.AsPort().Reader()
+	}
+	return os.Stdin
+}
+
+// inheritedOutput is where processes write when stdout or stderr aren't
+// redirected: the terminal, unless symbol is bound to another port.
+func inheritedOutput(environment *core.Environment, symbol string, standard string, file *os.File) io.Writer {
+	if out, stream := environment.Get(symbol), environment.Get(standard); !out.Compare(stream) && out.IsPort() && out.AsPort().IsOutput() {
+		return out.AsPort().Writer()
+	}
+	return file
+}
+
+func redirect(cmd *exec.Cmd, redirection shell.Redirection, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) (*os.File, error) {
+	targets, err := expandWord(redirection.Target, environment, eval, parser)
+	if err != nil {
+		return nil, err
+	} else if len(targets) != 1 {
+		return nil, errors.New("Error: ambiguous redirect.")
+	}
+
+	var file *os.File
+	switch redirection.Operator {
+	case "<":
+		if file, err = os.Open(resolvePath(environment, targets[0])); err == nil {
+			cmd.Stdin = file
+		}
+	case ">":
+		if file, err = os.Create(resolvePath(environment, targets[0])); err == nil {
+			cmd.Stdout = file
+		}
+	case ">>":
+		if file, err = os.OpenFile(resolvePath(environment, targets[0]), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666); err == nil {
+			cmd.Stdout = file
+		}
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: %s.", err.Error()))
+	}
+	return file, nil
+}
+
+// runShellPipeline starts pipeline as a job and, unless it runs in the
+// background, waits for it and returns the last command's exit status.
+func runShellPipeline(pipeline shell.Pipeline, background bool, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) (int, error) {
+	job, status, err := startShellPipeline(pipeline, !background, environment, eval, parser)
+	if job == nil || err != nil {
+		return status, err
+	}
+
+	jobs.add(job)
+	stderr := inheritedOutput(environment, "*err*", "*stderr*", os.Stderr)
+	if background {
+		fmt.Fprintf(stderr, "[%d] %d\n", job.id, job.pgid)
+		return 0, nil
+	}
+	return waitForeground(job, stderr), nil
+}
+
+// startShellPipeline starts the commands of pipeline, or returns the exit
+// status of a builtin or of commands failing to start.
+func startShellPipeline(pipeline shell.Pipeline, foreground bool, environment *core.Environment, eval func(*core.Type, *core.Environment) (*core.Type, error), parser core.Parser) (*job, int, error) {
+	stdout := inheritedOutput(environment, "*out*", "*stdout*", os.Stdout)
+	stderr := inheritedOutput(environment, "*err*", "*stderr*", os.Stderr)
+	commands, files, texts := make([]*exec.Cmd, 0), make([]*os.File, 0), make([]string, 0)
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	for _, command := range pipeline {
+		argv := make([]string, 0)
+		for _, word := range command.Words {
+			if arguments, err := expandWord(word, environment, eval, parser); err != nil {
+				return nil, 0, err
+			} else {
+				argv = append(argv, arguments...)
+			}
+		}
+		if len(argv) == 0 {
+			return nil, 0, errors.New("Error: empty command.")
+		}
+
+		// builtins act on the shell itself, so they can't be piped
+		if builtin, ok := shellBuiltins[argv[0]]; ok && len(pipeline) == 1 && len(command.Redirections) == 0 {
+			return nil, builtin(argv[1:], environment, stdout, stderr), nil
+		}
+
+		cmd := newProcess(context.Background(), environment, argv)
+		cmd.Stderr = stderr
+		commands, texts = append(commands, cmd), append(texts, strings.Join(argv, " "))
+	}
+
+	commands[0].Stdin = inheritedInput(environment)
+	commands[len(commands)-1].Stdout = stdout
+	for i := 0; i+1 < len(commands); i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, 0, errors.New(fmt.Sprintf("Error: %s.", err.Error()))
+		}
+		files = append(files, r, w)
+		commands[i].Stdout, commands[i+1].Stdin = w, r
+	}
+
+	// redirections take precedence over pipes
+	for i, command := range pipeline {
+		for _, redirection := range command.Redirections {
+			if file, err := redirect(commands[i], redirection, environment, eval, parser); err != nil {
+				return nil, 0, err
+			} else {
+				files = append(files, file)
+			}
+		}
+	}
+
+	job, err := startJob(commands, strings.Join(texts, " | "), foreground)
+	if err != nil {
+		fmt.Fprintf(stderr, "apocalisp: %s\n", err.Error())
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, 126, nil
+		}
+		return nil, 127, nil
+	}
+
+	// the children hold their own copies of the descriptors
+	for _, file := range files {
+		file.Close()
+	}
+	files = nil
+
+	return job, 0, nil
+}
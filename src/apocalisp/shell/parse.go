@@ -0,0 +1,92 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Redirection connects a command's stdin or stdout to a file. Operator is one
+// of `<`, `>` and `>>`.
+type Redirection struct {
+	Operator string
+	Target   Word
+}
+
+type Command struct {
+	Words        []Word
+	Redirections []Redirection
+}
+
+// Pipeline holds commands whose stdout feeds the next command's stdin.
+type Pipeline []Command
+
+// Chain holds pipelines joined by `&&` and `||`: Operators[i] is between
+// Pipelines[i] and Pipelines[i+1].
+type Chain struct {
+	Pipelines  []Pipeline
+	Operators  []string
+	Background bool
+}
+
+// Parse reads a command line into the chains separated by `;` and `&`.
+func Parse(line string) ([]Chain, error) {
+	tokens, err := tokenize(line)
+	if err != nil {
+		return nil, err
+	}
+
+	chains := make([]Chain, 0)
+	chain, pipeline, command := Chain{}, Pipeline{}, Command{}
+
+	endCommand := func(operator string) error {
+		if len(command.Words) == 0 {
+			return errors.New(fmt.Sprintf("Error: unexpected '%s'.", operator))
+		}
+		pipeline, command = append(pipeline, command), Command{}
+		return nil
+	}
+	endPipeline := func(operator string) error {
+		if err := endCommand(operator); err != nil {
+			return err
+		}
+		chain.Pipelines, pipeline = append(chain.Pipelines, pipeline), Pipeline{}
+		return nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch operator := tokens[i].operator; operator {
+		case "":
+			command.Words = append(command.Words, tokens[i].word)
+		case "<", ">", ">>":
+			if i+1 >= len(tokens) || tokens[i+1].operator != "" {
+				return nil, errors.New(fmt.Sprintf("Error: missing file name after '%s'.", operator))
+			}
+			i++
+			command.Redirections = append(command.Redirections, Redirection{Operator: operator, Target: tokens[i].word})
+		case "|":
+			if err := endCommand(operator); err != nil {
+				return nil, err
+			}
+		case "&&", "||":
+			if err := endPipeline(operator); err != nil {
+				return nil, err
+			}
+			chain.Operators = append(chain.Operators, operator)
+		case ";", "&":
+			if err := endPipeline(operator); err != nil {
+				return nil, err
+			}
+			chain.Background = operator == "&"
+			chains, chain = append(chains, chain), Chain{}
+		}
+	}
+
+	if len(command.Words) > 0 || len(command.Redirections) > 0 || len(pipeline) > 0 || len(chain.Operators) > 0 {
+		if err := endPipeline("EOF"); err != nil {
+			return nil, errors.New("Error: unexpected EOF.")
+		}
+		chains = append(chains, chain)
+	}
+
+	return chains, nil
+}
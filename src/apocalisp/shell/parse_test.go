@@ -0,0 +1,112 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func literal(texts ...string) []Word {
+	words := make([]Word, 0)
+	for _, text := range texts {
+		words = append(words, Word{{Text: text}})
+	}
+	return words
+}
+
+func Test_Parse_Words_And_Quoting(t *testing.T) {
+	chains, err := Parse(`ls -la 'a b' "c $d" e\ f ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Word{
+		{{Text: "ls"}},
+		{{Text: "-la"}},
+		{{Text: "a b", Quoted: true}},
+		{{Text: "c $d", Quoted: true}},
+		{{Text: "e"}, {Text: " ", Quoted: true}, {Text: "f"}},
+		{{Text: "", Quoted: true}},
+	}
+	if words := chains[0].Pipelines[0][0].Words; !reflect.DeepEqual(words, expected) {
+		t.Errorf("Parse() failed: %#v", words)
+	}
+}
+
+func Test_Parse_Lisp_Expressions(t *testing.T) {
+	chains, err := Parse(`echo $(str "a)" (+ 1 2)) x$(f)y "q$(g)"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Word{
+		{{Text: "echo"}},
+		{{Text: `(str "a)" (+ 1 2))`, Lisp: true}},
+		{{Text: "x"}, {Text: "(f)", Lisp: true}, {Text: "y"}},
+		{{Text: "q", Quoted: true}, {Text: "(g)", Lisp: true, Quoted: true}, {Text: "", Quoted: true}},
+	}
+	if words := chains[0].Pipelines[0][0].Words; !reflect.DeepEqual(words, expected) {
+		t.Errorf("Parse() failed: %#v", words)
+	}
+}
+
+func Test_Parse_Pipelines_And_Redirections(t *testing.T) {
+	chains, err := Parse(`sort < in.txt | uniq -c >> out.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Chain{{Pipelines: []Pipeline{{
+		{Words: literal("sort"), Redirections: []Redirection{{Operator: "<", Target: Word{{Text: "in.txt"}}}}},
+		{Words: literal("uniq", "-c"), Redirections: []Redirection{{Operator: ">>", Target: Word{{Text: "out.txt"}}}}},
+	}}}}
+	if !reflect.DeepEqual(chains, expected) {
+		t.Errorf("Parse() failed: %#v", chains)
+	}
+}
+
+func Test_Parse_Chains(t *testing.T) {
+	chains, err := Parse(`make && ./run || echo failed; sleep 1 & true # comment`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Chain{
+		{
+			Pipelines: []Pipeline{{{Words: literal("make")}}, {{Words: literal("./run")}}, {{Words: literal("echo", "failed")}}},
+			Operators: []string{"&&", "||"},
+		},
+		{Pipelines: []Pipeline{{{Words: literal("sleep", "1")}}}, Background: true},
+		{Pipelines: []Pipeline{{{Words: literal("true")}}}},
+	}
+	if !reflect.DeepEqual(chains, expected) {
+		t.Errorf("Parse() failed: %#v", chains)
+	}
+}
+
+func Test_Parse_Errors(t *testing.T) {
+	mapping := map[string]string{
+		`| grep x`:    "Error: unexpected '|'.",
+		`ls &&`:       "Error: unexpected EOF.",
+		`ls >`:        "Error: missing file name after '>'.",
+		`echo 'abc`:   "Error: unexpected EOF.",
+		`echo "abc`:   "Error: unexpected EOF.",
+		`echo $(f x`:  "Error: unexpected EOF.",
+		`echo \`:      "Error: unexpected EOF.",
+		`ls ; ; ls`:   "Error: unexpected ';'.",
+		`ls || && ls`: "Error: unexpected '&&'.",
+	}
+
+	for input, output := range mapping {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse() should have failed, but didn't. Input: `%s`.", input)
+		} else if err.Error() != output {
+			t.Errorf("Input `%s` should have yielded error `%s`, got `%s`.", input, output, err.Error())
+		}
+	}
+}
+
+func Test_Parse_Empty_Line(t *testing.T) {
+	if chains, err := Parse("   # just a comment"); err != nil || len(chains) != 0 {
+		t.Error("Parse() should return no chains for an empty line.")
+	}
+}
@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Segment is a piece of a word. Quoted segments are never globbed, and Lisp
+// segments hold the text of a `$(...)` expression, including its parens.
+type Segment struct {
+	Text   string
+	Quoted bool
+	Lisp   bool
+}
+
+// Word is a command line argument before expansion.
+type Word []Segment
+
+type token struct {
+	operator string
+	word     Word
+}
+
+var operators = []string{"&&", "||", ">>", "|", "&", ";", "<", ">"}
+
+func tokenize(line string) ([]token, error) {
+	runes := []rune(line)
+	tokens := make([]token, 0)
+	word, inWord := Word{}, false
+
+	appendText := func(text string, quoted bool) {
+		if n := len(word); n > 0 && !word[n-1].Lisp && word[n-1].Quoted == quoted {
+			word[n-1].Text += text
+		} else {
+			word = append(word, Segment{Text: text, Quoted: quoted})
+		}
+		inWord = true
+	}
+	endWord := func() {
+		if inWord {
+			tokens = append(tokens, token{word: word})
+		}
+		word, inWord = Word{}, false
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if unicode.IsSpace(r) {
+			endWord()
+		} else if r == '#' && !inWord {
+			break
+		} else if operator := matchOperator(runes[i:]); operator != "" {
+			endWord()
+			tokens = append(tokens, token{operator: operator})
+			i += len(operator) - 1
+		} else if r == '\\' {
+			if i+1 >= len(runes) {
+				return nil, errors.New("Error: unexpected EOF.")
+			}
+			i++
+			appendText(string(runes[i]), true)
+		} else if r == '\'' {
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, errors.New("Error: unexpected EOF.")
+			}
+			appendText(string(runes[i+1:end]), true)
+			i = end
+		} else if r == '"' {
+			end, err := readDoubleQuoted(runes, i+1, appendText, &word)
+			if err != nil {
+				return nil, err
+			}
+			inWord, i = true, end
+		} else if r == '$' && i+1 < len(runes) && runes[i+1] == '(' {
+			end, err := readLisp(runes, i+1)
+			if err != nil {
+				return nil, err
+			}
+			word = append(word, Segment{Text: string(runes[i+1 : end+1]), Lisp: true})
+			inWord, i = true, end
+		} else {
+			appendText(string(r), false)
+		}
+	}
+	endWord()
+
+	return tokens, nil
+}
+
+func matchOperator(runes []rune) string {
+	if len(runes) > 2 {
+		runes = runes[:2]
+	}
+	for _, operator := range operators {
+		if strings.HasPrefix(string(runes), operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// readDoubleQuoted reads up to the closing quote, honouring `\"`, `\\` and
+// `\$` escapes and `$(...)` expressions, and returns the quote's position.
+func readDoubleQuoted(runes []rune, from int, appendText func(string, bool), word *Word) (int, error) {
+	for i := from; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '"':
+			// an empty string is still an argument
+			appendText("", true)
+			return i, nil
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`, runes[i+1]):
+			i++
+			appendText(string(runes[i]), true)
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '(':
+			end, err := readLisp(runes, i+1)
+			if err != nil {
+				return 0, err
+			}
+			*word = append(*word, Segment{Text: string(runes[i+1 : end+1]), Lisp: true, Quoted: true})
+			i = end
+		default:
+			appendText(string(r), true)
+		}
+	}
+	return 0, errors.New("Error: unexpected EOF.")
+}
+
+// readLisp finds the paren closing the one at from, skipping over Lisp
+// strings, and returns its position.
+func readLisp(runes []rune, from int) (int, error) {
+	depth, inString := 0, false
+	for i := from; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case inString && r == '\\':
+			i++
+		case r == '"':
+			inString = !inString
+		case !inString && r == '(':
+			depth++
+		case !inString && r == ')':
+			if depth--; depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.New("Error: unexpected EOF.")
+}
@@ -0,0 +1,99 @@
+package apocalisp
+
+import (
+	"apocalisp/core"
+	"apocalisp/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Shell_Test(line string, file string, econtents string, t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	environment.Set("*shell-mode*", *core.NewBoolean(true))
+
+	if !IsShellLine(line, environment) {
+		t.Fatalf("`%s` should have been a command line.", line)
+	}
+
+	if err := RepShell(line, environment, Evaluate, parser.Parser{}); err != nil {
+		t.Errorf("`%s` failed: %s", line, err.Error())
+	} else if contents, err := os.ReadFile(file); err != nil {
+		t.Error(err)
+	} else if string(contents) != econtents {
+		t.Errorf("(output) `%s` != `%s` (expected)", string(contents), econtents)
+	}
+}
+
+func Test_Shell_Lines_Require_Shell_Mode(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+	environment.Set("*shell-mode*", *core.NewBoolean(false))
+
+	if IsShellLine("ls -la", environment) {
+		t.Error("Command lines should only run in shell mode.")
+	}
+
+	environment.Set("*shell-mode*", *core.NewBoolean(true))
+	if IsShellLine("  (+ 1 2)", environment) {
+		t.Error("s-expressions should still be evaluated in shell mode.")
+	}
+}
+
+func Test_Shell_Redirections_And_Pipes(t *testing.T) {
+	directory := t.TempDir()
+	out, in := filepath.Join(directory, "out.txt"), filepath.Join(directory, "in.txt")
+
+	Shell_Test("echo hello > "+out, out, "hello\n", t)
+	Shell_Test("echo again >> "+out, out, "hello\nagain\n", t)
+	Shell_Test("printf 'b\\na\\nb\\n' > "+in+" && sort < "+in+" | uniq > "+out, out, "a\nb\n", t)
+	Shell_Test("cat "+in+" | grep -c b > "+out, out, "2\n", t)
+}
+
+func Test_Shell_Quoting_And_Globbing(t *testing.T) {
+	directory := t.TempDir()
+	out := filepath.Join(directory, "out.txt")
+	os.WriteFile(filepath.Join(directory, "a.lisp"), []byte{}, 0666)
+	os.WriteFile(filepath.Join(directory, "b.lisp"), []byte{}, 0666)
+
+	Shell_Test("echo '*.lisp' \"a  b\" > "+out, out, "*.lisp a  b\n", t)
+	Shell_Test("ls "+directory+"/*.lisp > "+out, out, filepath.Join(directory, "a.lisp")+"\n"+filepath.Join(directory, "b.lisp")+"\n", t)
+	Shell_Test("echo "+directory+"/*.none > "+out, out, directory+"/*.none\n", t)
+}
+
+func Test_Shell_Lisp_Expansion(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	Shell_Test("echo $(+ 1 2) x$(str \"y\")z > "+out, out, "3 xyz\n", t)
+	Shell_Test("printf '%s,' $(list 1 \"a b\" 3) > "+out, out, "1,a b,3,", t)
+	Shell_Test("echo \"n=$(* 2 3)\" > "+out, out, "n=6\n", t)
+}
+
+func Test_Shell_Conditional_Chains(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	Shell_Test("false && echo no > "+out+" ; true || echo no > "+out+" ; echo yes > "+out, out, "yes\n", t)
+	Shell_Test("false || echo fallback > "+out, out, "fallback\n", t)
+}
+
+func Test_Shell_Exit_Status(t *testing.T) {
+	environment := DefaultEnvironment(parser.Parser{}, Evaluate)
+
+	RepShell("sh -c 'exit 4'", environment, Evaluate, parser.Parser{})
+	if status := environment.Get("*exit*"); status.ToString(true) != "4" {
+		t.Errorf("`*exit*` should be 4, got %s.", status.ToString(true))
+	}
+
+	stderr := core.NewStringOutputPort()
+	environment.Set("*err*", *stderr)
+	RepShell("apocalisp-no-such-program", environment, Evaluate, parser.Parser{})
+	if status := environment.Get("*exit*"); status.ToString(true) != "127" {
+		t.Errorf("`*exit*` should be 127, got %s.", status.ToString(true))
+	} else if !strings.Contains(stderr.AsPort().Contents(), "apocalisp-no-such-program") {
+		t.Error("Failing to start a command should be reported on `*err*`.")
+	}
+
+	if err := RepShell("echo $(undefined-symbol)", environment, Evaluate, parser.Parser{}); err == nil {
+		t.Error("Exceptions raised by `$(...)` should be reported.")
+	}
+}